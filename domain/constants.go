@@ -13,6 +13,32 @@ const (
 	RealTime     string = "realtime"
 	BetweenTimes string = "btimes"
 	FromDir      string = "fromdir"
+	Query        string = "query"
+	Trace        string = "trace"
+	Export       string = "export"
+	Search       string = "search"
 
-	LogTypeJson string = "json"
+	LogTypeJson     string = "json"
+	LogTypeLogfmt   string = "logfmt"
+	LogTypeKlog     string = "klog"
+	LogTypeCombined string = "combined"
+	LogTypeRegex    string = "regex"
+
+	// TimestampLayout is the format of the Node logger timestamps, used
+	// by the parsers to normalize the timestamps they extract.
+	TimestampLayout string = "2006-01-02T15:04:05.000-07:00"
+
+	StoreSqlite   string = "sqlite"
+	StorePostgres string = "postgres"
+	StoreDuckdb   string = "duckdb"
+
+	OutputTable string = "table"
+	OutputJson  string = "json"
+	OutputCsv   string = "csv"
+
+	OutputParquet string = "parquet"
+	OutputNdjson  string = "ndjson"
+
+	PartitionHour string = "hour"
+	PartitionPod  string = "pod"
 )
@@ -1,5 +1,10 @@
 package domain
 
+import (
+	"regexp"
+	"time"
+)
+
 type StrObject = map[string]string
 
 type CtxKeyType string
@@ -10,6 +15,189 @@ type Config struct {
 	LogDirectory  string `json:"logDirectory"`
 	StartTime     string `json:"startTime"`
 	EndTime       string `json:"endTime"`
+	// Timezone de las fechas sin zona: IANA, offset (-05:00) o UTC
+	Timezone string `json:"timezone"`
+
+	// Conexión al clúster: archivo kubeconfig, contexto y namespaces
+	// adicionales a Namespace
+	Kubeconfig string   `json:"kubeconfig"`
+	Context    string   `json:"context"`
+	Namespaces []string `json:"namespaces"`
+
+	// Cluster etiqueta las filas guardadas; Targets permite recolectar de
+	// varios clústeres a la vez, cada uno con su propia conexión
+	Cluster string         `json:"cluster"`
+	Targets []TargetConfig `json:"targets"`
+
+	// Store elige dónde se guardan los logs: sqlite (log.db local),
+	// postgres, una base compartida en PostgresDsn, o duckdb, un archivo
+	// local en DuckdbPath (por defecto log.duckdb junto a log.db)
+	Store       string `json:"store"`
+	PostgresDsn string `json:"postgresDsn"`
+	DuckdbPath  string `json:"duckdbPath"`
+
+	Parsers    []ParserConfig      `json:"parsers"`
+	Containers ContainerFilterType `json:"containers"`
+	Pods       PodFilterType       `json:"pods"`
+}
+
+// TargetConfig is one cluster to collect from. Empty fields take the
+// value of the top-level Config. Name defaults to Context.
+type TargetConfig struct {
+	Name          string   `json:"name"`
+	Kubeconfig    string   `json:"kubeconfig"`
+	Context       string   `json:"context"`
+	Namespace     string   `json:"namespace"`
+	Namespaces    []string `json:"namespaces"`
+	LabelSelector string   `json:"labelSelector"`
+}
+
+// PodFilterType narrows the pods selected by LabelSelector. FieldSelector
+// is sent to the API server (e.g. "spec.nodeName=node-1"); the rest is
+// checked on each pod. Owner is "<Kind>/<name>", e.g. "Deployment/api".
+type PodFilterType struct {
+	FieldSelector string    `json:"fieldSelector"`
+	Owner         string    `json:"owner"`
+	NameRegex     string    `json:"nameRegex"`
+	Annotations   StrObject `json:"annotations"`
+}
+
+// DownloadOptionsType tunes the btimes download. Zero values keep the
+// defaults: 4 workers and no byte or line limit per container.
+type DownloadOptionsType struct {
+	Workers    int
+	LimitBytes int64
+	TailLines  int64
+}
+
+// WriterOptionsType controls when the batch writers insert: every
+// BatchSize rows, every MaxBytes of data (0 without limit) or every
+// FlushInterval (0 disables it), whichever comes first.
+type WriterOptionsType struct {
+	BatchSize     int
+	MaxBytes      int
+	FlushInterval time.Duration
+}
+
+// StoreOptionsType locates the database: the log.db of Dir, dropping the
+// existing tables first when Reset is set.
+type StoreOptionsType struct {
+	Dir   string
+	Reset bool
+}
+
+// IngestOptionsType sizes the ingestion pipeline: parser workers and
+// lines queued per worker.
+type IngestOptionsType struct {
+	Workers   int
+	QueueSize int
+}
+
+// IngestStatsType are the metrics of the ingestion pipeline. Blocked
+// counts the pushes that found the queue full and BlockedTime the time
+// the streams waited for it.
+type IngestStatsType struct {
+	Queued      int64
+	Processed   int64
+	Pending     int
+	MaxDepth    int
+	Blocked     int64
+	BlockedTime time.Duration
+}
+
+// IngestSummaryType are the totals of a run: lines read, parsed, kept in
+// raw_lines because no parser understood them, and rows stored or failed
+// in general_logs and raw_lines.
+type IngestSummaryType struct {
+	Read     int64
+	Parsed   int64
+	Unparsed int64
+	Stored   int64
+	Failed   int64
+}
+
+// ContainerFilterType limits the containers whose logs are collected.
+// An empty Include means every container (init containers included).
+type ContainerFilterType struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+// ParserConfig selects how the lines of the pods matching Selector are
+// parsed. An empty Selector matches every pod and is also used for
+// the fromdir flow.
+type ParserConfig struct {
+	Selector string `json:"selector"`
+	Type     string `json:"type"`
+	// Fields maps a LogType field (level, timestamp, hostname, traceId,
+	// spanId, parentId, msg) to the key or group holding it in the line.
+	Fields  StrObject `json:"fields"`
+	Pattern string    `json:"pattern"`
+}
+
+// LogFilter holds the criteria used to search general_logs. Empty
+// fields are ignored.
+type LogFilter struct {
+	Level     string
+	TraceId   string
+	Hostname  string
+	Cluster   string
+	Pod       string
+	Namespace string
+	Container string
+	From      time.Time
+	To        time.Time
+	Msg       string
+	MsgRegex  *regexp.Regexp
+	Limit     int
+	// SourceOrder orders the rows by cluster, namespace and pod before
+	// the timestamp, so the rows of each pod come together.
+	SourceOrder bool
+}
+
+// LogSourceType tells where a line was read from. Pod, namespace,
+// container and node are empty for the fromdir flow.
+type LogSourceType struct {
+	Cluster   string `json:"cluster,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Container string `json:"container,omitempty"`
+	Node      string `json:"node,omitempty"`
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	// Restart is the restart count of the container instance that
+	// wrote the line.
+	Restart int32 `json:"restart,omitempty"`
+}
+
+// StreamCheckpointType is the position reached in the log stream of a
+// container, used to resume it without duplicating or missing lines.
+// LinesAtTimestamp counts the lines already read with LastTimestamp,
+// since several lines can share it.
+type StreamCheckpointType struct {
+	Cluster          string
+	Namespace        string
+	Pod              string
+	Container        string
+	Restart          int32
+	LastTimestamp    time.Time
+	LinesAtTimestamp int
+	Line             int
+}
+
+// GeneralLogRecordType is a general_logs row: the parsed entry plus
+// where it was read from.
+type GeneralLogRecordType struct {
+	LogType
+	Source LogSourceType `json:"source"`
+}
+
+// RawLineType is a line that no parser understood, kept in raw_lines.
+type RawLineType struct {
+	Source     LogSourceType
+	IngestTime time.Time
+	Timestamp  string
+	Text       string
 }
 
 type LogChanDataType struct {
@@ -38,3 +226,88 @@ type PerformanceType struct {
 	MemoryUsage string  `json:"memoryUsage"`
 	Percentage  string  `json:"percentage"`
 }
+
+// PerformanceRecordType is a row of performance_logs.
+type PerformanceRecordType struct {
+	TraceId     string  `json:"traceId"`
+	Method      string  `json:"method"`
+	Exectime    float32 `json:"exectime"`
+	MemoryUsage string  `json:"memoryUsage"`
+	Timestamp   string  `json:"timestamp"`
+}
+
+// ExportLogRow is a general_logs row as written by the export flow, with
+// the source columns at the top level so pandas and Spark load a flat
+// table. Timestamp is a Parquet timestamp, so the files can be filtered
+// by time; when the text of the log is not RFC3339 it is empty and the
+// text is kept in TimestampText.
+type ExportLogRow struct {
+	Level         string    `parquet:"level"`
+	Timestamp     time.Time `parquet:"timestamp,optional,timestamp(microsecond)"`
+	Hostname      string    `parquet:"hostname"`
+	TraceId       string    `parquet:"trace_id"`
+	SpanId        string    `parquet:"span_id"`
+	ParentId      string    `parquet:"parent_id"`
+	Msg           string    `parquet:"msg"`
+	Cluster       string    `parquet:"cluster"`
+	Pod           string    `parquet:"pod"`
+	Namespace     string    `parquet:"namespace"`
+	Container     string    `parquet:"container"`
+	Node          string    `parquet:"node"`
+	File          string    `parquet:"source_file"`
+	Line          int       `parquet:"line_offset"`
+	Restart       int32     `parquet:"restart_count"`
+	TimestampText string    `parquet:"timestamp_text,optional"`
+}
+
+// ExportPerformanceRow is a performance_logs row as written by the export
+// flow, with the timestamp of ExportLogRow.
+type ExportPerformanceRow struct {
+	TraceId       string    `parquet:"trace_id"`
+	Method        string    `parquet:"method"`
+	Exectime      float32   `parquet:"exectime"`
+	MemoryUsage   string    `parquet:"memory_mb"`
+	Timestamp     time.Time `parquet:"timestamp,optional,timestamp(microsecond)"`
+	TimestampText string    `parquet:"timestamp_text,optional"`
+}
+
+// ExportOptionsType tells the export flow where and how to write the
+// files. Partition is empty, PartitionHour or PartitionPod; the hours are
+// taken in Location.
+type ExportOptionsType struct {
+	Dir       string
+	Format    string
+	Partition string
+	Location  *time.Location
+}
+
+// SearchOptionsType is a full-text search of the messages. Query uses
+// the FTS5 syntax (terms, "phrases", prefix*, AND, OR, NOT, NEAR) and the
+// matched terms of the snippet are wrapped in HighlightStart and
+// HighlightEnd. SnippetTokens bounds the length of the snippet.
+type SearchOptionsType struct {
+	Query          string
+	HighlightStart string
+	HighlightEnd   string
+	SnippetTokens  int
+}
+
+// SearchResultType is a general_logs row matched by a search, with the
+// fragment of the message around the matched terms.
+type SearchResultType struct {
+	GeneralLogRecordType
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+// TraceSpanType is a node of a reconstructed trace: the entries logged
+// under one span id, ordered by time, plus its child spans.
+type TraceSpanType struct {
+	SpanId      string
+	ParentId    string
+	Start       time.Time
+	End         time.Time
+	Entries     []LogType
+	Performance []PerformanceRecordType
+	Children    []*TraceSpanType
+}
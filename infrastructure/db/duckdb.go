@@ -0,0 +1,46 @@
+//go:build duckdb
+
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "github.com/marcboeker/go-duckdb"
+)
+
+// duckdbSchema creates the log tables, with no id nor indexes: the
+// appender writes every column, and DuckDB scans by column with its own
+// min/max statistics, which is what the analysis queries need.
+var duckdbSchema = logTablesSchema(map[columnKind]string{
+	textColumn:      "VARCHAR",
+	integerColumn:   "INTEGER",
+	realColumn:      "DOUBLE",
+	timestampColumn: "TIMESTAMPTZ",
+}, "")
+
+// OpenDuckDB opens the DuckDB file at path, creating it and the log
+// tables when missing. DuckDB allows a single process per file, so the
+// collectors writing at the same time need their own file.
+func OpenDuckDB(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), DirGrants(true, true, true)); err != nil {
+		return nil, fmt.Errorf("error creando directorio de la base de datos: %w", err)
+	}
+
+	conn, err := sql.Open("duckdb", path)
+	if err != nil {
+		return nil, fmt.Errorf("open duckdb error: %w", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ping error: %w", err)
+	}
+	if _, err := conn.Exec(duckdbSchema); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error creando tablas en duckdb: %w", err)
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// columnKind is the kind of a log column, mapped to the type of each
+// engine by logTablesSchema.
+type columnKind int
+
+const (
+	textColumn columnKind = iota
+	integerColumn
+	realColumn
+	timestampColumn
+)
+
+type logColumn struct {
+	name string
+	kind columnKind
+}
+
+type logTable struct {
+	name    string
+	columns []logColumn
+}
+
+// logTables are the tables written by the Postgres and DuckDB sinks. They
+// mirror the SQLite tables of the collectors, at the latest migration,
+// with two differences. The timestamps are timestamp columns, and
+// timestamp_text keeps the original text of a timestamp that does not
+// parse, which SQLite stores as is. The text columns have no length limit,
+// like in SQLite, since one long value would fail the whole batch.
+//
+// The columns follow the order of the rows of the sinks, which the DuckDB
+// appender writes by position, so a new column goes at the end.
+var logTables = []logTable{
+	{
+		name: "performance_logs",
+		columns: []logColumn{
+			{"trace_id", textColumn},
+			{"method", textColumn},
+			{"exectime", realColumn},
+			{"memory_mb", textColumn},
+			{"timestamp", timestampColumn},
+			{"timestamp_text", textColumn},
+		},
+	},
+	{
+		name: "general_logs",
+		columns: []logColumn{
+			{"level", textColumn},
+			{"timestamp", timestampColumn},
+			{"hostname", textColumn},
+			{"trace_id", textColumn},
+			{"span_id", textColumn},
+			{"parent_id", textColumn},
+			{"msg", textColumn},
+			{"cluster", textColumn},
+			{"pod", textColumn},
+			{"namespace", textColumn},
+			{"container", textColumn},
+			{"node", textColumn},
+			{"source_file", textColumn},
+			{"line_offset", integerColumn},
+			{"restart_count", integerColumn},
+			{"timestamp_text", textColumn},
+		},
+	},
+	{
+		name: "raw_lines",
+		columns: []logColumn{
+			{"cluster", textColumn},
+			{"pod", textColumn},
+			{"namespace", textColumn},
+			{"container", textColumn},
+			{"node", textColumn},
+			{"file", textColumn},
+			{"line_number", integerColumn},
+			{"restart_count", integerColumn},
+			{"ingest_time", timestampColumn},
+			{"timestamp", timestampColumn},
+			{"text", textColumn},
+			{"timestamp_text", textColumn},
+		},
+	},
+}
+
+// LogColumns returns the columns of the log table, in the order of the
+// rows of the sinks.
+func LogColumns(table string) []string {
+	for _, t := range logTables {
+		if t.name != table {
+			continue
+		}
+		names := make([]string, len(t.columns))
+		for i, column := range t.columns {
+			names[i] = column.name
+		}
+		return names
+	}
+
+	return nil
+}
+
+// logTablesSchema builds the statements creating logTables with the
+// column types of an engine. id is the definition of a leading id column,
+// empty for none. The tables created before a column was added get it with
+// ADD COLUMN, which keeps it last.
+func logTablesSchema(types map[columnKind]string, id string) string {
+	var schema strings.Builder
+	for _, table := range logTables {
+		definitions := make([]string, 0, len(table.columns)+1)
+		if id != "" {
+			definitions = append(definitions, id)
+		}
+		for _, column := range table.columns {
+			definitions = append(definitions, column.name+" "+types[column.kind])
+		}
+		fmt.Fprintf(&schema, "CREATE TABLE IF NOT EXISTS %s (\n\t%s\n);\n", table.name, strings.Join(definitions, ",\n\t"))
+		for _, column := range table.columns {
+			fmt.Fprintf(&schema, "ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s;\n", table.name, column.name, types[column.kind])
+		}
+	}
+
+	return schema.String()
+}
@@ -0,0 +1,231 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// migration is a forward-only schema change. Versions must be
+// consecutive and never edited once released: add a new entry instead.
+type migration struct {
+	version int
+	name    string
+	stmt    string
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create performance_logs and general_logs",
+		stmt: `
+			CREATE TABLE IF NOT EXISTS performance_logs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				trace_id TEXT NOT NULL,
+				method TEXT,
+				exectime INTEGER,
+				memory_mb VARCHAR(10),
+				timestamp DATETIME
+			);
+			CREATE TABLE IF NOT EXISTS general_logs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				level CHARACTER(15),
+				timestamp DATETIME,
+				pid NUMERIC,
+				hostname VARCHAR(255),
+				trace_id VARCHAR(40),
+				span_id VARCHAR(40),
+				parent_id VARCHAR(40),
+				msg TEXT
+			);
+		`,
+	},
+	{
+		version: 2,
+		name:    "create raw_lines",
+		stmt: `
+			CREATE TABLE IF NOT EXISTS raw_lines (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				pod VARCHAR(255),
+				file TEXT,
+				line_number INTEGER,
+				ingest_time DATETIME,
+				timestamp DATETIME,
+				text TEXT
+			);
+		`,
+	},
+	{
+		version: 3,
+		name:    "add source columns",
+		stmt: `
+			ALTER TABLE general_logs ADD COLUMN pod VARCHAR(255);
+			ALTER TABLE general_logs ADD COLUMN namespace VARCHAR(255);
+			ALTER TABLE general_logs ADD COLUMN container VARCHAR(255);
+			ALTER TABLE general_logs ADD COLUMN node VARCHAR(255);
+			ALTER TABLE general_logs ADD COLUMN source_file TEXT;
+			ALTER TABLE general_logs ADD COLUMN line_offset INTEGER;
+			ALTER TABLE raw_lines ADD COLUMN namespace VARCHAR(255);
+			ALTER TABLE raw_lines ADD COLUMN container VARCHAR(255);
+			ALTER TABLE raw_lines ADD COLUMN node VARCHAR(255);
+		`,
+	},
+	{
+		version: 4,
+		name:    "add restart_count",
+		stmt: `
+			ALTER TABLE general_logs ADD COLUMN restart_count INTEGER DEFAULT 0;
+			ALTER TABLE raw_lines ADD COLUMN restart_count INTEGER DEFAULT 0;
+		`,
+	},
+	{
+		version: 5,
+		name:    "create stream_checkpoints",
+		stmt: `
+			CREATE TABLE IF NOT EXISTS stream_checkpoints (
+				namespace VARCHAR(255) NOT NULL,
+				pod VARCHAR(255) NOT NULL,
+				container VARCHAR(255) NOT NULL,
+				restart_count INTEGER NOT NULL DEFAULT 0,
+				last_timestamp TEXT NOT NULL,
+				lines_at_timestamp INTEGER NOT NULL DEFAULT 0,
+				line INTEGER NOT NULL DEFAULT 0,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (namespace, pod, container)
+			);
+		`,
+	},
+	{
+		version: 6,
+		name:    "add cluster",
+		stmt: `
+			ALTER TABLE general_logs ADD COLUMN cluster VARCHAR(255) DEFAULT '';
+			ALTER TABLE raw_lines ADD COLUMN cluster VARCHAR(255) DEFAULT '';
+			CREATE TABLE stream_checkpoints_v6 (
+				cluster VARCHAR(255) NOT NULL DEFAULT '',
+				namespace VARCHAR(255) NOT NULL,
+				pod VARCHAR(255) NOT NULL,
+				container VARCHAR(255) NOT NULL,
+				restart_count INTEGER NOT NULL DEFAULT 0,
+				last_timestamp TEXT NOT NULL,
+				lines_at_timestamp INTEGER NOT NULL DEFAULT 0,
+				line INTEGER NOT NULL DEFAULT 0,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (cluster, namespace, pod, container)
+			);
+			INSERT INTO stream_checkpoints_v6
+			(namespace, pod, container, restart_count, last_timestamp, lines_at_timestamp, line, updated_at)
+			SELECT namespace, pod, container, restart_count, last_timestamp, lines_at_timestamp, line, updated_at
+			FROM stream_checkpoints;
+			DROP TABLE stream_checkpoints;
+			ALTER TABLE stream_checkpoints_v6 RENAME TO stream_checkpoints;
+		`,
+	},
+	{
+		// The timestamp and level indexes are on the expressions the
+		// queries compare, otherwise SQLite cannot use them.
+		version: 7,
+		name:    "index general_logs",
+		stmt: `
+			CREATE INDEX IF NOT EXISTS general_logs_trace_id ON general_logs (trace_id);
+			CREATE INDEX IF NOT EXISTS general_logs_timestamp ON general_logs (julianday(timestamp));
+			CREATE INDEX IF NOT EXISTS general_logs_level ON general_logs (UPPER(TRIM(level)));
+			CREATE INDEX IF NOT EXISTS general_logs_hostname ON general_logs (hostname);
+			CREATE INDEX IF NOT EXISTS performance_logs_trace_id ON performance_logs (trace_id);
+		`,
+	},
+}
+
+// managedTables lists every table created by the migrations, used by
+// ResetSchema to restore the old destructive behaviour on demand.
+var managedTables = []string{
+	"performance_logs",
+	"general_logs",
+	"raw_lines",
+	"stream_checkpoints",
+}
+
+// Migrate upgrades the schema of conn to the latest version, applying
+// each pending migration inside its own transaction.
+func Migrate(conn *sql.DB) error {
+	_, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			name TEXT,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creando schema_version: %w", err)
+	}
+
+	current, err := SchemaVersion(conn)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := conn.Begin()
+		if err != nil {
+			return fmt.Errorf("migración %d: %w", m.version, err)
+		}
+		if _, err := tx.Exec(m.stmt); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migración %d (%s): %w", m.version, m.name, err)
+		}
+		if _, err := tx.Exec(
+			"INSERT INTO schema_version (version, name) VALUES (?, ?)",
+			m.version,
+			m.name,
+		); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migración %d: %w", m.version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migración %d: %w", m.version, err)
+		}
+		log.Printf("Migración aplicada [%d] %s", m.version, m.name)
+	}
+
+	return nil
+}
+
+// SchemaVersion returns the latest applied migration, or 0 for a
+// database that has never been migrated.
+func SchemaVersion(conn *sql.DB) (int, error) {
+	var version int
+	err := conn.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("error leyendo schema_version: %w", err)
+	}
+
+	return version, nil
+}
+
+// LatestVersion is the version a database has after Migrate.
+func LatestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// ResetSchema drops every managed table, including schema_version and
+// the search index, so the next Migrate starts from an empty database.
+func ResetSchema(conn *sql.DB) error {
+	// Dropping the FTS5 table needs the module, even in a build without it
+	if _, err := conn.Exec("DROP TABLE IF EXISTS " + searchTable); err != nil {
+		return fmt.Errorf("error eliminando %s, compile con -tags sqlite_fts5 o borre log.db: %w", searchTable, err)
+	}
+	for i := len(managedTables) - 1; i >= 0; i-- {
+		if _, err := conn.Exec("DROP TABLE IF EXISTS " + managedTables[i]); err != nil {
+			return fmt.Errorf("error eliminando %s: %w", managedTables[i], err)
+		}
+	}
+	if _, err := conn.Exec("DROP TABLE IF EXISTS schema_version"); err != nil {
+		return fmt.Errorf("error eliminando schema_version: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresSchemaLock is the advisory lock key taken while creating the
+// schema.
+const postgresSchemaLock = 7_245_310
+
+// postgresSchema creates the log tables. Every statement is idempotent,
+// so the collectors of a campaign can share the database and create it on
+// first use. The DO block widens the VARCHAR columns of the databases
+// created before.
+var postgresSchema = logTablesSchema(map[columnKind]string{
+	textColumn:      "TEXT",
+	integerColumn:   "INTEGER",
+	realColumn:      "DOUBLE PRECISION",
+	timestampColumn: "TIMESTAMPTZ",
+}, "id BIGSERIAL PRIMARY KEY") + `
+	DO $$
+	DECLARE c record;
+	BEGIN
+		FOR c IN
+			SELECT table_name, column_name FROM information_schema.columns
+			WHERE table_schema = current_schema()
+			AND table_name IN ('performance_logs', 'general_logs', 'raw_lines')
+			AND data_type = 'character varying'
+		LOOP
+			EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE TEXT', c.table_name, c.column_name);
+		END LOOP;
+	END $$;
+	CREATE INDEX IF NOT EXISTS general_logs_trace_id ON general_logs (trace_id);
+	CREATE INDEX IF NOT EXISTS general_logs_timestamp ON general_logs (timestamp);
+	CREATE INDEX IF NOT EXISTS general_logs_level ON general_logs (level);
+	CREATE INDEX IF NOT EXISTS general_logs_hostname ON general_logs (hostname);
+	CREATE INDEX IF NOT EXISTS performance_logs_trace_id ON performance_logs (trace_id);
+`
+
+// OpenPostgres connects to the PostgreSQL database of dsn and creates the
+// log tables when missing. An empty dsn takes the connection from the
+// PGHOST, PGUSER, PGDATABASE... environment variables.
+func OpenPostgres(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("dsn de postgres inválido: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("ping error: %w", err)
+	}
+	if err := createPostgresSchema(ctx, pool); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("error creando tablas en postgres: %w", err)
+	}
+
+	return pool, nil
+}
+
+// createPostgresSchema runs postgresSchema holding an advisory lock, since
+// CREATE TABLE IF NOT EXISTS fails when two collectors start together.
+func createPostgresSchema(ctx context.Context, pool *pgxpool.Pool) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", postgresSchemaLock); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, postgresSchema); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
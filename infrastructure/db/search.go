@@ -0,0 +1,97 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// searchTable is the FTS5 index of general_logs.msg. It is an external
+// content table: it stores only the index and reads the text from
+// general_logs, so the messages are not kept twice.
+const searchTable = "general_logs_fts"
+
+// searchIndexStmt creates the index and the triggers that keep it in
+// sync, so every insert of the writers is indexed in its own transaction.
+const searchIndexStmt = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS general_logs_fts USING fts5(
+		msg,
+		content='general_logs',
+		content_rowid='id'
+	);
+	CREATE TRIGGER IF NOT EXISTS general_logs_fts_insert AFTER INSERT ON general_logs BEGIN
+		INSERT INTO general_logs_fts (rowid, msg) VALUES (new.id, new.msg);
+	END;
+	CREATE TRIGGER IF NOT EXISTS general_logs_fts_delete AFTER DELETE ON general_logs BEGIN
+		INSERT INTO general_logs_fts (general_logs_fts, rowid, msg) VALUES ('delete', old.id, old.msg);
+	END;
+	CREATE TRIGGER IF NOT EXISTS general_logs_fts_update AFTER UPDATE OF msg ON general_logs BEGIN
+		INSERT INTO general_logs_fts (general_logs_fts, rowid, msg) VALUES ('delete', old.id, old.msg);
+		INSERT INTO general_logs_fts (rowid, msg) VALUES (new.id, new.msg);
+	END;
+`
+
+// searchTriggers are dropped when the SQLite library has no FTS5, since
+// they would make every insert into general_logs fail.
+var searchTriggers = []string{
+	"general_logs_fts_insert",
+	"general_logs_fts_delete",
+	"general_logs_fts_update",
+}
+
+// EnsureSearchIndex creates the full-text index of the messages and
+// reports whether it is available. FTS5 is only compiled into
+// go-sqlite3 with the sqlite_fts5 build tag; without it the triggers are
+// removed and the index is rebuilt the next time a build with FTS5 opens
+// the database, so the rows inserted meanwhile are not missed.
+func EnsureSearchIndex(conn *sql.DB) (bool, error) {
+	var enabled bool
+	if err := conn.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); err != nil {
+		return false, fmt.Errorf("error consultando soporte de FTS5: %w", err)
+	}
+
+	var synced bool
+	err := conn.QueryRow(
+		"SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'trigger' AND name = ?",
+		searchTriggers[0],
+	).Scan(&synced)
+	if err != nil {
+		return false, fmt.Errorf("error consultando el índice de búsqueda: %w", err)
+	}
+
+	if !enabled {
+		if synced {
+			for _, trigger := range searchTriggers {
+				if _, err := conn.Exec("DROP TRIGGER IF EXISTS " + trigger); err != nil {
+					return false, fmt.Errorf("error eliminando %s: %w", trigger, err)
+				}
+			}
+			log.Println("SQLite sin FTS5: el índice de búsqueda se reconstruirá al compilar con -tags sqlite_fts5")
+		}
+		return false, nil
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error creando el índice de búsqueda: %w", err)
+	}
+	if _, err := tx.Exec(searchIndexStmt); err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("error creando el índice de búsqueda: %w", err)
+	}
+	// Without the triggers the index is new or missed some inserts
+	if !synced {
+		if _, err := tx.Exec("INSERT INTO general_logs_fts (general_logs_fts) VALUES ('rebuild')"); err != nil {
+			tx.Rollback()
+			return false, fmt.Errorf("error reconstruyendo el índice de búsqueda: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error creando el índice de búsqueda: %w", err)
+	}
+	if !synced {
+		log.Println("Índice de búsqueda de mensajes actualizado")
+	}
+
+	return true, nil
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDsnOptions apply to every connection of the pool. WAL lets the
+// queries read while the writers insert, and synchronous=NORMAL only
+// syncs on checkpoints: a crash can lose the last transactions but never
+// corrupts the file. busy_timeout waits for a lock instead of failing.
+const sqliteDsnOptions = "?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000"
+
+// defaultVariableLimit is the SQLITE_MAX_VARIABLE_NUMBER of the SQLite
+// builds before 3.32, used when the limit cannot be read.
+const defaultVariableLimit = 999
+
+// Store is the SQLite database of a run. It is opened once and shared by
+// the flows and the writers, which makes the location of log.db explicit.
+type Store struct {
+	conn          *sql.DB
+	path          string
+	variableLimit int
+	fullText      bool
+}
+
+// NewStore opens the log.db of options.Dir, or of the working directory
+// when it is empty, migrates its schema and creates the search index.
+// With options.Reset the existing tables are dropped first.
+func NewStore(options domain.StoreOptionsType) (*Store, error) {
+	dir := options.Dir
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, DirGrants(true, true, true)); err != nil {
+		return nil, fmt.Errorf("error creando directorio de la base de datos: %w", err)
+	}
+	path := filepath.Join(dir, "log.db")
+
+	conn, err := sql.Open("sqlite3", path+sqliteDsnOptions)
+	if err != nil {
+		return nil, fmt.Errorf("open db error: %w", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ping error: %w", err)
+	}
+
+	if options.Reset {
+		if err := ResetSchema(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		log.Println("Esquema eliminado (reset)")
+	}
+	if err := Migrate(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	log.Printf("Esquema en versión %d", LatestVersion())
+	fullText, err := EnsureSearchIndex(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Store{
+		conn:          conn,
+		path:          path,
+		variableLimit: variableLimit(conn),
+		fullText:      fullText,
+	}, nil
+}
+
+// variableLimit reads the maximum number of ? parameters of a statement
+// from the SQLite library linked in.
+func variableLimit(conn *sql.DB) int {
+	limit := defaultVariableLimit
+	c, err := conn.Conn(context.Background())
+	if err != nil {
+		return limit
+	}
+	defer c.Close()
+
+	c.Raw(func(driverConn any) error {
+		if sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn); ok {
+			limit = sqliteConn.GetLimit(sqlite3.SQLITE_LIMIT_VARIABLE_NUMBER)
+		}
+		return nil
+	})
+
+	return limit
+}
+
+// DB returns the connection pool of the store.
+func (s *Store) DB() *sql.DB {
+	return s.conn
+}
+
+// VariableLimit returns the maximum number of ? parameters a statement
+// can have.
+func (s *Store) VariableLimit() int {
+	return s.variableLimit
+}
+
+// FullTextSearch reports whether the messages have a full-text index,
+// which needs a build with the sqlite_fts5 tag.
+func (s *Store) FullTextSearch() bool {
+	return s.fullText
+}
+
+// Path returns the location of the database file.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Close closes the database. Queued rows must be flushed before.
+func (s *Store) Close() error {
+	return s.conn.Close()
+}
+
+func DirGrants(leer bool, escribir bool, ejecutar bool) os.FileMode {
+	perm := 0
+	if leer {
+		perm |= 4
+	}
+	if escribir {
+		perm |= 2
+	}
+	if ejecutar {
+		perm |= 1
+	}
+	// Aplicar los permisos para el propietario, grupo y otros de forma idéntica
+	// para este ejemplo simple. Puedes ajustarlo si necesitas más granularidad.
+	fileMode := os.FileMode(perm<<6 | perm<<3 | perm)
+	// Añadir el bit de directorio
+	return fileMode | os.ModeDir
+}
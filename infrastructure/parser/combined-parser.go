@@ -0,0 +1,51 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+)
+
+func init() {
+	Register(domain.LogTypeCombined, func(cfg domain.ParserConfig) (Parser, error) {
+		return &combinedParser{}, nil
+	})
+}
+
+// 10.0.0.1 - - [15/May/2025:17:22:59 -0500] "GET /charges HTTP/1.1" 200 512 "-" "curl/8.0"
+var combinedRegex = regexp.MustCompile(
+	`^(\S+) \S+ \S+ \[([^\]]+)\] "([^"]*)" (\d{3}) (\S+)(?: "([^"]*)" "([^"]*)")?`,
+)
+
+// combinedParser reads the nginx/Apache combined access log format (the
+// common format is accepted too). The level is derived from the status.
+type combinedParser struct{}
+
+func (p *combinedParser) Parse(line string) (domain.LogType, error) {
+	match := combinedRegex.FindStringSubmatch(line)
+	if match == nil {
+		return domain.LogType{}, fmt.Errorf("la línea no tiene formato combined")
+	}
+
+	t, err := time.Parse("02/Jan/2006:15:04:05 -0700", match[2])
+	if err != nil {
+		return domain.LogType{}, err
+	}
+
+	status, _ := strconv.Atoi(match[4])
+	level := "INFO"
+	if status >= 500 {
+		level = "ERROR"
+	} else if status >= 400 {
+		level = "WARN"
+	}
+
+	return domain.LogType{
+		Level:     level,
+		Timestamp: t.Format(domain.TimestampLayout),
+		Msg:       fmt.Sprintf("%s %s %s %s", match[1], match[3], match[4], match[5]),
+	}, nil
+}
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/utils"
+)
+
+func init() {
+	Register(domain.LogTypeJson, func(cfg domain.ParserConfig) (Parser, error) {
+		for field := range cfg.Fields {
+			if !isLogField(field) {
+				return nil, fmt.Errorf("campo desconocido en fields: %s", field)
+			}
+		}
+		return &jsonParser{fields: cfg.Fields}, nil
+	})
+}
+
+// jsonParser reads one JSON object per line. Without field mapping it
+// behaves exactly like utils.GetLogItem; with it, every field is looked
+// up by key, where nested keys are written as "a.b".
+type jsonParser struct {
+	fields domain.StrObject
+}
+
+func (p *jsonParser) Parse(line string) (domain.LogType, error) {
+	if len(p.fields) == 0 {
+		return utils.GetLogItem(line)
+	}
+
+	var object map[string]any
+	if err := json.Unmarshal([]byte(line), &object); err != nil {
+		return domain.LogType{}, err
+	}
+
+	var log domain.LogType
+	for _, field := range logFields {
+		key, ok := p.fields[field]
+		if !ok {
+			key = field
+		}
+		if value, found := lookupJson(object, key); found {
+			setField(&log, field, value)
+		}
+	}
+
+	return log, nil
+}
+
+func lookupJson(object map[string]any, key string) (string, bool) {
+	var current any = object
+	for _, part := range strings.Split(key, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if current, ok = m[part]; !ok {
+			return "", false
+		}
+	}
+
+	switch value := current.(type) {
+	case nil:
+		return "", false
+	case string:
+		return value, true
+	case float64, bool:
+		return fmt.Sprint(value), true
+	default:
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", false
+		}
+		return string(raw), true
+	}
+}
+
+func isLogField(name string) bool {
+	for _, field := range logFields {
+		if field == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+)
+
+func init() {
+	Register(domain.LogTypeKlog, func(cfg domain.ParserConfig) (Parser, error) {
+		return &klogParser{now: time.Now}, nil
+	})
+}
+
+var (
+	// I0515 17:22:59.820123   12345 server.go:123] message
+	klogRegex = regexp.MustCompile(`^([IWEF])(\d{2})(\d{2}) (\d{2}:\d{2}:\d{2}(?:\.\d+)?)\s+\d+ ([^\]]+)\] ?(.*)$`)
+	// 2025/05/15 17:22:59 message (Go standard library log)
+	goLogRegex = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?) (.*)$`)
+
+	klogLevels = domain.StrObject{
+		"I": "INFO",
+		"W": "WARNING",
+		"E": "ERROR",
+		"F": "FATAL",
+	}
+)
+
+// klogParser reads the text format of klog/glog and of the Go standard
+// log package. Neither carries a year or a zone, so the local ones are
+// assumed.
+type klogParser struct {
+	now func() time.Time
+}
+
+func (p *klogParser) Parse(line string) (domain.LogType, error) {
+	if match := klogRegex.FindStringSubmatch(line); match != nil {
+		now := p.now()
+		t, err := time.ParseInLocation(
+			"2006 01 02 15:04:05",
+			fmt.Sprintf("%d %s %s %s", now.Year(), match[2], match[3], match[4]),
+			now.Location(),
+		)
+		if err != nil {
+			return domain.LogType{}, err
+		}
+		// Lines from December read in January belong to last year.
+		if t.After(now.Add(24 * time.Hour)) {
+			t = t.AddDate(-1, 0, 0)
+		}
+
+		return domain.LogType{
+			Level:     klogLevels[match[1]],
+			Timestamp: t.Format(domain.TimestampLayout),
+			Msg:       strings.TrimSpace(match[6]),
+		}, nil
+	}
+
+	if match := goLogRegex.FindStringSubmatch(line); match != nil {
+		t, err := time.ParseInLocation("2006/01/02 15:04:05", match[1], p.now().Location())
+		if err != nil {
+			return domain.LogType{}, err
+		}
+
+		return domain.LogType{
+			Timestamp: t.Format(domain.TimestampLayout),
+			Msg:       match[2],
+		}, nil
+	}
+
+	return domain.LogType{}, fmt.Errorf("la línea no tiene formato klog")
+}
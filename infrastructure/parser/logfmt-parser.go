@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmticonap/real-logs/domain"
+)
+
+func init() {
+	Register(domain.LogTypeLogfmt, func(cfg domain.ParserConfig) (Parser, error) {
+		for field := range cfg.Fields {
+			if !isLogField(field) {
+				return nil, fmt.Errorf("campo desconocido en fields: %s", field)
+			}
+		}
+		return &logfmtParser{fields: cfg.Fields}, nil
+	})
+}
+
+// logfmtAliases are the keys tried for each field when fields does not
+// map it explicitly.
+var logfmtAliases = map[string][]string{
+	"level":     {"level", "lvl", "severity"},
+	"timestamp": {"ts", "time", "timestamp"},
+	"hostname":  {"hostname", "host"},
+	"traceId":   {"traceId", "trace_id", "trace"},
+	"spanId":    {"spanId", "span_id", "span"},
+	"parentId":  {"parentId", "parent_id"},
+	"msg":       {"msg", "message"},
+}
+
+// logfmtParser reads key=value pairs, with double quoted values when
+// they contain spaces: level=info msg="charge created" ts=...
+type logfmtParser struct {
+	fields domain.StrObject
+}
+
+func (p *logfmtParser) Parse(line string) (domain.LogType, error) {
+	pairs := parseLogfmt(line)
+	if len(pairs) == 0 {
+		return domain.LogType{}, fmt.Errorf("la línea no tiene formato logfmt")
+	}
+
+	var log domain.LogType
+	for _, field := range logFields {
+		keys := logfmtAliases[field]
+		if key, ok := p.fields[field]; ok {
+			keys = []string{key}
+		}
+		for _, key := range keys {
+			if value, ok := pairs[key]; ok {
+				setField(&log, field, value)
+				break
+			}
+		}
+	}
+
+	return log, nil
+}
+
+func parseLogfmt(line string) domain.StrObject {
+	pairs := domain.StrObject{}
+	i := 0
+	for i < len(line) {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' {
+			i++
+		}
+		key := line[start:i]
+		if i >= len(line) || line[i] != '=' {
+			// A bare word is not logfmt; give up on the whole line.
+			if key != "" {
+				return domain.StrObject{}
+			}
+			continue
+		}
+		i++
+
+		var value string
+		if i < len(line) && line[i] == '"' {
+			var b strings.Builder
+			i++
+			for i < len(line) && line[i] != '"' {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+				}
+				b.WriteByte(line[i])
+				i++
+			}
+			if i >= len(line) {
+				return domain.StrObject{}
+			}
+			i++
+			value = b.String()
+		} else {
+			start = i
+			for i < len(line) && line[i] != ' ' {
+				i++
+			}
+			value = line[start:i]
+		}
+
+		if key == "" {
+			return domain.StrObject{}
+		}
+		pairs[key] = value
+	}
+
+	return pairs
+}
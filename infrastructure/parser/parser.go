@@ -0,0 +1,155 @@
+package parser
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/utils"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Parser turns a raw log line into a LogType. It returns an error when
+// the line does not have the shape the parser understands.
+type Parser interface {
+	Parse(line string) (domain.LogType, error)
+}
+
+// Factory builds a Parser from its config entry.
+type Factory func(cfg domain.ParserConfig) (Parser, error)
+
+var (
+	factories      = map[string]Factory{}
+	factoriesMutex sync.RWMutex
+)
+
+// Register makes a parser type available to config.json. It is called
+// from the init of every parser in this package and can be used to add
+// new ones.
+func Register(name string, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+	factories[name] = factory
+}
+
+// New builds the parser described by cfg. An empty type means json.
+func New(cfg domain.ParserConfig) (Parser, error) {
+	name := cfg.Type
+	if name == "" {
+		name = domain.LogTypeJson
+	}
+
+	factoriesMutex.RLock()
+	factory, ok := factories[name]
+	factoriesMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("tipo de parser desconocido: %s", name)
+	}
+
+	return factory(cfg)
+}
+
+type registryEntry struct {
+	selector labels.Selector
+	parser   Parser
+}
+
+// Registry picks the parser of a pod from its labels, in the order the
+// parsers were declared in config.json.
+type Registry struct {
+	entries  []registryEntry
+	fallback Parser
+}
+
+// NewRegistry builds every parser of cfgs. The first entry without
+// selector is the default parser; without one, the json parser is used.
+func NewRegistry(cfgs []domain.ParserConfig) (*Registry, error) {
+	registry := &Registry{}
+
+	for i, cfg := range cfgs {
+		p, err := New(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("parser %d: %w", i, err)
+		}
+
+		if cfg.Selector == "" {
+			if registry.fallback == nil {
+				registry.fallback = p
+			}
+			continue
+		}
+
+		selector, err := labels.Parse(cfg.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("parser %d: selector inválido: %w", i, err)
+		}
+		registry.entries = append(registry.entries, registryEntry{
+			selector: selector,
+			parser:   p,
+		})
+	}
+
+	if registry.fallback == nil {
+		registry.fallback = &jsonParser{}
+	}
+
+	return registry, nil
+}
+
+// ForLabels returns the first parser whose selector matches podLabels,
+// or the default parser.
+func (r *Registry) ForLabels(podLabels map[string]string) Parser {
+	for _, entry := range r.entries {
+		if entry.selector.Matches(labels.Set(podLabels)) {
+			return entry.parser
+		}
+	}
+
+	return r.fallback
+}
+
+// Default returns the parser used when there are no pod labels.
+func (r *Registry) Default() Parser {
+	return r.fallback
+}
+
+// setField assigns value to the LogType field called name. It reports
+// false for unknown names. Timestamps are normalized to
+// domain.TimestampLayout, like the klog and combined parsers do; one that
+// cannot be parsed is kept as found.
+func setField(log *domain.LogType, name, value string) bool {
+	switch name {
+	case "level":
+		log.Level = value
+	case "timestamp":
+		log.Timestamp = value
+		if t, err := utils.ParseTimestamp(value); err == nil {
+			log.Timestamp = t.Format(domain.TimestampLayout)
+		}
+	case "hostname":
+		log.Hostname = value
+	case "traceId":
+		log.TraceId = value
+	case "spanId":
+		log.SpanId = value
+	case "parentId":
+		log.ParentId = value
+	case "msg":
+		log.Msg = value
+	default:
+		return false
+	}
+
+	return true
+}
+
+// logFields are the LogType fields that can be mapped from config.
+var logFields = []string{
+	"level",
+	"timestamp",
+	"hostname",
+	"traceId",
+	"spanId",
+	"parentId",
+	"msg",
+}
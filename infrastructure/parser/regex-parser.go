@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/jmticonap/real-logs/domain"
+)
+
+func init() {
+	Register(domain.LogTypeRegex, func(cfg domain.ParserConfig) (Parser, error) {
+		if cfg.Pattern == "" {
+			return nil, fmt.Errorf("el parser regex requiere pattern")
+		}
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("pattern inválido: %w", err)
+		}
+
+		groups := map[string]int{}
+		for _, field := range logFields {
+			group := field
+			if mapped, ok := cfg.Fields[field]; ok {
+				group = mapped
+			}
+			if index := re.SubexpIndex(group); index >= 0 {
+				groups[field] = index
+			}
+		}
+		if len(groups) == 0 {
+			return nil, fmt.Errorf("pattern no tiene grupos con nombre utilizables")
+		}
+
+		return &regexParser{re: re, groups: groups}, nil
+	})
+}
+
+// regexParser fills the LogType from the named groups of a pattern,
+// e.g. `^(?P<timestamp>\S+) (?P<level>\w+) (?P<msg>.*)$`. Groups named
+// differently can be mapped with fields. groups holds the submatch index
+// of each field, looked up once when the parser is built.
+type regexParser struct {
+	re     *regexp.Regexp
+	groups map[string]int
+}
+
+func (p *regexParser) Parse(line string) (domain.LogType, error) {
+	match := p.re.FindStringSubmatch(line)
+	if match == nil {
+		return domain.LogType{}, fmt.Errorf("la línea no coincide con el pattern")
+	}
+
+	var log domain.LogType
+	for field, index := range p.groups {
+		setField(&log, field, match[index])
+	}
+
+	return log, nil
+}
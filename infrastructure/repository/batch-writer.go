@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+)
+
+// writers tracks the batch writers, so WaitWriters can wait for their
+// final drain.
+var writers sync.WaitGroup
+
+// runBatchWriter reads items from ch and inserts them in batches. A batch
+// is flushed when it reaches options.BatchSize items or options.MaxBytes,
+// or every options.FlushInterval, so rows of a quiet service do not sit in
+// memory. When ctx is cancelled the items left in ch are drained and the
+// last batch is inserted before returning. ctx only stops the writer: the
+// inserts never see it cancelled, so a batch flushed while it stops is
+// not lost.
+func runBatchWriter[T any](
+	ctx context.Context,
+	name string,
+	ch <-chan T,
+	options domain.WriterOptionsType,
+	size func(T) int,
+	insert func(context.Context, []T),
+) {
+	writers.Add(1)
+	go func() {
+		defer writers.Done()
+
+		insertCtx := context.WithoutCancel(ctx)
+		var batch []T
+		batchBytes := 0
+		flush := func() {
+			if len(batch) > 0 {
+				insert(insertCtx, batch)
+				batch = batch[:0]
+			}
+			batchBytes = 0
+		}
+		add := func(item T) {
+			batch = append(batch, item)
+			batchBytes += size(item)
+			if len(batch) >= options.BatchSize || (options.MaxBytes > 0 && batchBytes >= options.MaxBytes) {
+				flush()
+			}
+		}
+
+		var tick <-chan time.Time
+		if options.FlushInterval > 0 {
+			ticker := time.NewTicker(options.FlushInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+			drain:
+				for {
+					select {
+					case item := <-ch:
+						batch = append(batch, item)
+						if len(batch) >= options.BatchSize {
+							flush()
+						}
+					default:
+						break drain
+					}
+				}
+				flush()
+				log.Printf("Finalizando %s writer", name)
+				return
+
+			case <-tick:
+				flush()
+
+			case item := <-ch:
+				add(item)
+			}
+		}
+	}()
+}
+
+// WaitWriters blocks until every batch writer has drained its channel
+// and inserted its last batch. The writers stop when their context is
+// cancelled.
+func WaitWriters() {
+	writers.Wait()
+}
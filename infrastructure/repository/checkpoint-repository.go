@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+)
+
+// GetCheckpoint returns the saved position of the container stream of
+// source. The bool is false when the container was never streamed.
+func GetCheckpoint(
+	ctx context.Context,
+	db *sql.DB,
+	source domain.LogSourceType,
+) (domain.StreamCheckpointType, bool, error) {
+	checkpoint := domain.StreamCheckpointType{
+		Cluster:   source.Cluster,
+		Namespace: source.Namespace,
+		Pod:       source.Pod,
+		Container: source.Container,
+	}
+
+	var lastTimestamp string
+	err := db.QueryRowContext(
+		ctx,
+		`
+		SELECT restart_count, last_timestamp, lines_at_timestamp, line
+		FROM stream_checkpoints
+		WHERE cluster = ? AND namespace = ? AND pod = ? AND container = ?
+		`,
+		source.Cluster,
+		source.Namespace,
+		source.Pod,
+		source.Container,
+	).Scan(
+		&checkpoint.Restart,
+		&lastTimestamp,
+		&checkpoint.LinesAtTimestamp,
+		&checkpoint.Line,
+	)
+	if err == sql.ErrNoRows {
+		return checkpoint, false, nil
+	}
+	if err != nil {
+		return checkpoint, false, fmt.Errorf("error leyendo checkpoint: %w", err)
+	}
+
+	checkpoint.LastTimestamp, err = time.Parse(time.RFC3339Nano, lastTimestamp)
+	if err != nil {
+		return checkpoint, false, fmt.Errorf("checkpoint inválido: %w", err)
+	}
+
+	return checkpoint, true, nil
+}
+
+// SaveCheckpoint inserts or replaces the position of a container stream.
+func SaveCheckpoint(
+	ctx context.Context,
+	db *sql.DB,
+	checkpoint domain.StreamCheckpointType,
+) error {
+	_, err := db.ExecContext(
+		ctx,
+		`
+		INSERT INTO stream_checkpoints
+		(cluster, namespace, pod, container, restart_count, last_timestamp, lines_at_timestamp, line, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (cluster, namespace, pod, container) DO UPDATE SET
+			restart_count = excluded.restart_count,
+			last_timestamp = excluded.last_timestamp,
+			lines_at_timestamp = excluded.lines_at_timestamp,
+			line = excluded.line,
+			updated_at = excluded.updated_at
+		`,
+		checkpoint.Cluster,
+		checkpoint.Namespace,
+		checkpoint.Pod,
+		checkpoint.Container,
+		checkpoint.Restart,
+		checkpoint.LastTimestamp.UTC().Format(time.RFC3339Nano),
+		checkpoint.LinesAtTimestamp,
+		checkpoint.Line,
+	)
+	if err != nil {
+		return fmt.Errorf("error guardando checkpoint: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !duckdb
+
+package repository
+
+import "errors"
+
+// NewDuckDBSink fails in the builds without the duckdb tag, which keep
+// the binary free of the DuckDB library.
+func NewDuckDBSink(path string) (LogSink, error) {
+	return nil, errors.New("DuckDB no disponible: compile con -tags duckdb (make build-duckdb)")
+}
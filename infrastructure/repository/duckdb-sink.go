@@ -0,0 +1,97 @@
+//go:build duckdb
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/db"
+	"github.com/marcboeker/go-duckdb"
+)
+
+// duckdbSink writes the batches in a local DuckDB file with the appender,
+// the bulk load of DuckDB, inside a transaction per batch.
+type duckdbSink struct {
+	db *sql.DB
+}
+
+// NewDuckDBSink opens the DuckDB file at path, creating the tables when
+// missing.
+func NewDuckDBSink(path string) (LogSink, error) {
+	conn, err := db.OpenDuckDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &duckdbSink{db: conn}, nil
+}
+
+func (s *duckdbSink) Close() error {
+	return s.db.Close()
+}
+
+func (s *duckdbSink) InsertPerformanceLogs(ctx context.Context, batch []domain.LogChanDataType) error {
+	return s.append(ctx, "performance_logs", len(batch), func(i int) []any {
+		return performanceRow(batch[i])
+	})
+}
+
+func (s *duckdbSink) InsertGeneralLogs(ctx context.Context, batch []domain.GeneralLogRecordType) error {
+	return s.append(ctx, "general_logs", len(batch), func(i int) []any {
+		return generalLogRow(batch[i])
+	})
+}
+
+func (s *duckdbSink) InsertRawLines(ctx context.Context, batch []domain.RawLineType) error {
+	return s.append(ctx, "raw_lines", len(batch), func(i int) []any {
+		return rawLineRow(batch[i])
+	})
+}
+
+// append writes rows rows of table with an appender of its own
+// connection. The appender flushes on its own every few thousand rows, so
+// the transaction keeps the batch whole when a row fails.
+func (s *duckdbSink) append(ctx context.Context, table string, rows int, values func(i int) []any) error {
+	if rows == 0 {
+		return nil
+	}
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = conn.Raw(func(driverConn any) error {
+		appender, err := duckdb.NewAppenderFromConn(driverConn.(driver.Conn), "", table)
+		if err != nil {
+			return err
+		}
+		var row []driver.Value
+		for i := range rows {
+			row = row[:0]
+			for _, value := range values(i) {
+				row = append(row, value)
+			}
+			if err := appender.AppendRow(row...); err != nil {
+				appender.Close()
+				return err
+			}
+		}
+		return appender.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("error insertando en %s: %w", table, err)
+	}
+
+	return tx.Commit()
+}
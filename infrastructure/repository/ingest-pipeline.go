@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/parser"
+)
+
+// ingestReportInterval is how often the pipeline metrics are logged
+// while there is activity.
+const ingestReportInterval = 30 * time.Second
+
+// ingestLine is a line read from a container waiting to be parsed.
+type ingestLine struct {
+	parser     parser.Parser
+	source     domain.LogSourceType
+	line       string
+	logPerform bool
+	ack        lineAck
+}
+
+// ingestPipeline parses the collected lines with a fixed pool of workers.
+// Each worker owns a bounded queue and every pod is always sent to the
+// same one, so the lines of a pod keep their order. A full queue blocks
+// the stream that reads the pod, which slows it down instead of piling
+// up goroutines.
+type ingestPipeline struct {
+	shards []chan ingestLine
+	wg     sync.WaitGroup
+
+	queued      atomic.Int64
+	processed   atomic.Int64
+	blocked     atomic.Int64
+	blockedTime atomic.Int64
+	maxDepth    atomic.Int64
+}
+
+var ingest atomic.Pointer[ingestPipeline]
+
+// StartIngestPipeline starts the parser workers used by IngestPush. The
+// metrics are logged periodically until ctx is cancelled. A second call
+// while a pipeline is running is ignored, its workers would never be
+// stopped.
+func StartIngestPipeline(ctx context.Context, options domain.IngestOptionsType) {
+	workers := max(options.Workers, 1)
+	queueSize := max(options.QueueSize, 1)
+
+	pipeline := &ingestPipeline{shards: make([]chan ingestLine, workers)}
+	for i := range pipeline.shards {
+		shard := make(chan ingestLine, queueSize)
+		pipeline.shards[i] = shard
+		pipeline.wg.Add(1)
+		go func() {
+			defer pipeline.wg.Done()
+			for item := range shard {
+				saveLine(item.parser, item.source, item.line, item.logPerform, item.ack)
+				pipeline.processed.Add(1)
+			}
+		}()
+	}
+	if !ingest.CompareAndSwap(nil, pipeline) {
+		for _, shard := range pipeline.shards {
+			close(shard)
+		}
+		log.Printf("Pipeline de ingesta ya iniciado, se ignora el nuevo inicio")
+		return
+	}
+	log.Printf("Pipeline de ingesta: %d workers, cola de %d líneas por worker", workers, queueSize)
+
+	go func() {
+		ticker := time.NewTicker(ingestReportInterval)
+		defer ticker.Stop()
+		var last int64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if stats := pipeline.stats(); stats.Queued != last {
+					last = stats.Queued
+					logIngestStats(stats)
+				}
+			}
+		}
+	}()
+}
+
+// IngestPush queues line for parsing. It blocks while the queue of the pod
+// is full, even after ctx is cancelled, so a line already read is never
+// lost: the workers keep running until StopIngestPipeline. Without a
+// started pipeline the line is parsed right away.
+func IngestPush(
+	ctx context.Context,
+	p parser.Parser,
+	source domain.LogSourceType,
+	line string,
+) {
+	ingestPush(ctx, p, source, line, lineAck{})
+}
+
+// IngestPushTracked queues line like IngestPush and acknowledges it to
+// tracker once its row is stored. The line must have been tracked with
+// source.Line as its number.
+func IngestPushTracked(
+	ctx context.Context,
+	p parser.Parser,
+	source domain.LogSourceType,
+	line string,
+	tracker *LineTracker,
+) {
+	ingestPush(ctx, p, source, line, lineAck{tracker: tracker, line: source.Line})
+}
+
+func ingestPush(
+	ctx context.Context,
+	p parser.Parser,
+	source domain.LogSourceType,
+	line string,
+	ack lineAck,
+) {
+	counters.read.Add(1)
+	logPerform, _ := ctx.Value(domain.CtxKeyType("logPerform")).(bool)
+	pipeline := ingest.Load()
+	if pipeline == nil {
+		saveLine(p, source, line, logPerform, ack)
+		return
+	}
+
+	item := ingestLine{parser: p, source: source, line: line, logPerform: logPerform, ack: ack}
+	shard := pipeline.shards[shardIndex(source, len(pipeline.shards))]
+
+	select {
+	case shard <- item:
+	default:
+		// Cola llena: se espera al worker (backpressure)
+		pipeline.blocked.Add(1)
+		start := time.Now()
+		shard <- item
+		pipeline.blockedTime.Add(int64(time.Since(start)))
+	}
+
+	pipeline.queued.Add(1)
+	depth := int64(len(shard))
+	for {
+		current := pipeline.maxDepth.Load()
+		if depth <= current || pipeline.maxDepth.CompareAndSwap(current, depth) {
+			break
+		}
+	}
+}
+
+// StopIngestPipeline waits until every queued line is parsed and returns
+// the final metrics. IngestPush must not be called afterwards.
+func StopIngestPipeline() domain.IngestStatsType {
+	pipeline := ingest.Swap(nil)
+	if pipeline == nil {
+		return domain.IngestStatsType{}
+	}
+
+	for _, shard := range pipeline.shards {
+		close(shard)
+	}
+	pipeline.wg.Wait()
+
+	stats := pipeline.stats()
+	logIngestStats(stats)
+
+	return stats
+}
+
+// IngestStats returns the current metrics of the pipeline.
+func IngestStats() domain.IngestStatsType {
+	if pipeline := ingest.Load(); pipeline != nil {
+		return pipeline.stats()
+	}
+
+	return domain.IngestStatsType{}
+}
+
+func (p *ingestPipeline) stats() domain.IngestStatsType {
+	depth := 0
+	for _, shard := range p.shards {
+		depth += len(shard)
+	}
+
+	return domain.IngestStatsType{
+		Queued:      p.queued.Load(),
+		Processed:   p.processed.Load(),
+		Pending:     depth,
+		MaxDepth:    int(p.maxDepth.Load()),
+		Blocked:     p.blocked.Load(),
+		BlockedTime: time.Duration(p.blockedTime.Load()),
+	}
+}
+
+func logIngestStats(stats domain.IngestStatsType) {
+	log.Printf(
+		"Ingesta: encoladas=%d procesadas=%d pendientes=%d máx. cola=%d bloqueos=%d espera=%s",
+		stats.Queued,
+		stats.Processed,
+		stats.Pending,
+		stats.MaxDepth,
+		stats.Blocked,
+		stats.BlockedTime.Round(time.Millisecond),
+	)
+}
+
+// shardIndex assigns the worker of a pod container, or of a file for
+// the lines read from a directory.
+func shardIndex(source domain.LogSourceType, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(source.Cluster + "/" + source.Namespace + "/" + source.Pod + "/" + source.Container + "/" + source.File))
+
+	return int(h.Sum32() % uint32(shards))
+}
+
+// counters are the totals of the run shown by the final summary.
+var counters struct {
+	read     atomic.Int64
+	parsed   atomic.Int64
+	unparsed atomic.Int64
+	stored   atomic.Int64
+	failed   atomic.Int64
+}
+
+// IngestSummary returns the totals of lines read, parsed and stored since
+// the process started.
+func IngestSummary() domain.IngestSummaryType {
+	return domain.IngestSummaryType{
+		Read:     counters.read.Load(),
+		Parsed:   counters.parsed.Load(),
+		Unparsed: counters.unparsed.Load(),
+		Stored:   counters.stored.Load(),
+		Failed:   counters.failed.Load(),
+	}
+}
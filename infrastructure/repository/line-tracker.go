@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+)
+
+// LineTracker follows the lines of a container stream until the writers
+// store them, so the checkpoint of the stream never moves past a line
+// that is not in the database yet. The saved checkpoint is the position
+// after the last line of an uninterrupted run of stored lines.
+type LineTracker struct {
+	mu        sync.Mutex
+	pending   []trackedLine
+	committed domain.StreamCheckpointType
+	changed   bool
+	closed    bool
+	failed    bool
+	lastSave  time.Time
+	interval  time.Duration
+	save      func(domain.StreamCheckpointType)
+}
+
+// trackedLine is a line waiting for its row to be stored, with the
+// checkpoint reached after reading it.
+type trackedLine struct {
+	checkpoint domain.StreamCheckpointType
+	stored     bool
+}
+
+// lineAck tells the tracker of a stream that the row of one of its lines
+// was stored. The zero value belongs to a line without tracker.
+type lineAck struct {
+	tracker *LineTracker
+	line    int
+}
+
+// NewLineTracker starts tracking a stream from checkpoint. save is called
+// with the committed checkpoint at most every interval, and once more
+// when the stream is closed and all its lines are stored.
+func NewLineTracker(
+	checkpoint domain.StreamCheckpointType,
+	interval time.Duration,
+	save func(domain.StreamCheckpointType),
+) *LineTracker {
+	return &LineTracker{
+		committed: checkpoint,
+		interval:  interval,
+		save:      save,
+		lastSave:  time.Now(),
+	}
+}
+
+// Track registers the line checkpoint.Line before it is queued. Lines
+// must be tracked in the order they are read.
+func (t *LineTracker) Track(checkpoint domain.StreamCheckpointType) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failed {
+		return
+	}
+	t.pending = append(t.pending, trackedLine{checkpoint: checkpoint})
+}
+
+// Close marks the end of the stream: no more lines are tracked and the
+// checkpoint is saved as soon as every pending line is stored.
+func (t *LineTracker) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	t.saveIfDue()
+}
+
+// stored acknowledges the row of line. With ok false the row could not be
+// inserted: the checkpoint stays where it is, so the line is read again
+// by the next run.
+func (t *LineTracker) stored(line int, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failed || len(t.pending) == 0 {
+		return
+	}
+	if !ok {
+		t.failed = true
+		t.pending = nil
+		log.Printf(
+			"Checkpoint de %s/%s detenido: hay líneas que no se guardaron",
+			t.committed.Pod,
+			t.committed.Container,
+		)
+		return
+	}
+
+	if i := line - t.pending[0].checkpoint.Line; i >= 0 && i < len(t.pending) {
+		t.pending[i].stored = true
+	}
+	for len(t.pending) > 0 && t.pending[0].stored {
+		t.committed = t.pending[0].checkpoint
+		t.changed = true
+		t.pending = t.pending[1:]
+	}
+	t.saveIfDue()
+}
+
+// saveIfDue saves the committed checkpoint when the interval elapsed or
+// the stream ended with every line stored. It runs holding mu, so the
+// saves of both writers cannot overtake each other.
+func (t *LineTracker) saveIfDue() {
+	if !t.changed || t.failed {
+		return
+	}
+	if time.Since(t.lastSave) < t.interval && !(t.closed && len(t.pending) == 0) {
+		return
+	}
+	t.changed = false
+	t.lastSave = time.Now()
+	t.save(t.committed)
+}
+
+// ack acknowledges the row of a tracked line, if any.
+func (a lineAck) ack(ok bool) {
+	if a.tracker != nil {
+		a.tracker.stored(a.line, ok)
+	}
+}
@@ -2,107 +2,160 @@ package repository
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"log"
-	"strings"
 	"time"
 
 	"github.com/jmticonap/real-logs/domain"
-	"github.com/jmticonap/real-logs/infrastructure/db"
+	"github.com/jmticonap/real-logs/infrastructure/parser"
 	"github.com/jmticonap/real-logs/utils"
 )
 
 var logChan = make(chan domain.LogChanDataType, 1000)
-var generalLogChan = make(chan domain.LogType, 1000)
+var generalLogChan = make(chan queuedRow[domain.GeneralLogRecordType], 1000)
+var rawLineChan = make(chan queuedRow[domain.RawLineType], 1000)
+
+// queuedRow is a row waiting for its writer, with the stream line it was
+// read from. The line is acknowledged once the batch is inserted.
+type queuedRow[T any] struct {
+	row T
+	ack lineAck
+}
+
+func GeneralChanPush(logData domain.LogType, source domain.LogSourceType) {
+	pushGeneralLog(logData, source, lineAck{})
+}
+
+func pushGeneralLog(logData domain.LogType, source domain.LogSourceType, ack lineAck) {
+	generalLogChan <- queuedRow[domain.GeneralLogRecordType]{
+		row: domain.GeneralLogRecordType{
+			LogType: logData,
+			Source:  source,
+		},
+		ack: ack,
+	}
+}
+
+// RawLineChanPush queues a line that could not be parsed, so it is kept
+// in raw_lines instead of being discarded.
+func RawLineChanPush(source domain.LogSourceType, line string) {
+	pushRawLine(source, line, lineAck{})
+}
 
-func GeneralChanPush(logData domain.LogType) {
-	generalLogChan <- logData
+func pushRawLine(source domain.LogSourceType, line string, ack lineAck) {
+	rawLine := domain.RawLineType{
+		Source:     source,
+		IngestTime: time.Now(),
+		Text:       line,
+	}
+	if t, err := utils.ExtractTimestamp(line); err == nil {
+		rawLine.Timestamp = t.Format(time.RFC3339Nano)
+	}
+	rawLineChan <- queuedRow[domain.RawLineType]{row: rawLine, ack: ack}
 }
 
+// LogChanPush queues the performance data of logData for
+// performance_logs. Entries without a valid timestamp are skipped, since
+// the rows are ordered by it.
 func LogChanPush(
 	logData domain.LogType,
 	performanceData []domain.PerformanceType,
 ) {
-	t, err := time.Parse("2006-01-02T15:04:05.000-07:00", logData.Timestamp)
+	t, err := time.Parse(domain.TimestampLayout, logData.Timestamp)
 	if err != nil {
-		log.Panicf("Error parsing: %s", err)
+		log.Printf("Performance descartado, timestamp inválido (trace %s): %s", logData.TraceId, err)
 		return
 	}
 
-	var params []any = []any{}
+	timestamp := t.Format(time.RFC3339Nano)
 	for _, perform := range performanceData {
-		params = append(
-			params,
-			logData.TraceId,
-			perform.Method,
-			perform.Exectime,
-			perform.MemoryUsage,
-			t.Format(time.RFC3339Nano),
-		)
-
+		// Cada fila tiene su propio slice: el writer la lee después
 		logChan <- domain.LogChanDataType{
-			Params: params,
+			Params: []any{
+				logData.TraceId,
+				perform.Method,
+				perform.Exectime,
+				perform.MemoryUsage,
+				timestamp,
+			},
 		}
-		params = params[:0]
 	}
 }
 
-func StartWriterWorker(ctx context.Context, batchSize int) {
-	go func() {
-		db := db.OpenDb(domain.StrObject{})
-		var batch []domain.LogChanDataType
-		for {
-			select {
-			case <-ctx.Done():
-				if len(batch) > 0 {
-					insertBatchPerformanceLog(ctx, db, &batch)
-				}
-				log.Println("Finalizando SQLite writer")
-				return
-
-			case LogQueryData := <-logChan:
-				batch = append(batch, LogQueryData)
-
-				if len(batch) >= batchSize {
-					insertBatchPerformanceLog(ctx, db, &batch)
-				}
-			}
+func StartWriterWorker(ctx context.Context, sink LogSink, options domain.WriterOptionsType) {
+	runBatchWriter(ctx, "performance", logChan, options, func(item domain.LogChanDataType) int {
+		// Cada fila de performance es pequeña y de tamaño similar
+		return 16 * len(item.Params)
+	}, func(ctx context.Context, batch []domain.LogChanDataType) {
+		if err := sink.InsertPerformanceLogs(ctx, batch); err != nil {
+			log.Printf("Error inserting performance log data: %s", err)
+		} else {
+			fmt.Printf("\r[Performance] Saved data: BatchSize=%d", len(batch))
+		}
+	})
+}
+
+func StartGeneralLogWorker(ctx context.Context, sink LogSink, options domain.WriterOptionsType) {
+	runBatchWriter(ctx, "general log", generalLogChan, options, func(queued queuedRow[domain.GeneralLogRecordType]) int {
+		item := queued.row
+		return len(item.Msg) + len(item.Timestamp) + len(item.TraceId) + len(item.SpanId) + len(item.ParentId) +
+			len(item.Hostname) + len(item.Source.Pod) + len(item.Source.Container) + len(item.Source.File)
+	}, func(ctx context.Context, batch []queuedRow[domain.GeneralLogRecordType]) {
+		err := sink.InsertGeneralLogs(ctx, rowsOf(batch))
+		countStored(err, len(batch))
+		ackRows(batch, err == nil)
+		if err != nil {
+			log.Printf("Error inserting general log data: %s", err)
+		} else {
+			fmt.Printf("\r[General] Saved data: BatchSize=%d", len(batch))
 		}
-	}()
+	})
 }
 
-func StartGeneralLogWorker(ctx context.Context, batchSize int) {
-	go func() {
-		db := db.OpenDb(domain.StrObject{})
-		var batch []domain.LogType
-		for {
-			select {
-			case <-ctx.Done():
-				if len(batch) > 0 {
-					insertBatchGeneralLog(ctx, db, &batch)
-				}
-				log.Println("Finalizando general log SQLite writer")
-				return
-
-			case logData := <-generalLogChan:
-				batch = append(batch, logData)
-
-				if len(batch) >= batchSize {
-					insertBatchGeneralLog(ctx, db, &batch)
-				}
-			}
+func StartRawLineWorker(ctx context.Context, sink LogSink, options domain.WriterOptionsType) {
+	runBatchWriter(ctx, "raw lines", rawLineChan, options, func(queued queuedRow[domain.RawLineType]) int {
+		item := queued.row
+		return len(item.Text) + len(item.Source.Pod) + len(item.Source.Container) + len(item.Source.File)
+	}, func(ctx context.Context, batch []queuedRow[domain.RawLineType]) {
+		err := sink.InsertRawLines(ctx, rowsOf(batch))
+		countStored(err, len(batch))
+		ackRows(batch, err == nil)
+		if err != nil {
+			log.Printf("Error inserting raw line data: %s", err)
+		} else {
+			fmt.Printf("\r[Raw] Saved data: BatchSize=%d", len(batch))
 		}
-	}()
+	})
 }
 
-func SaveLog(ctx context.Context, line string) {
-	logPerform := ctx.Value(domain.CtxKeyType("logPerform")).(bool)
-	log, err := utils.GetLogItem(line)
+// SaveLog parses line and queues it for general_logs, or for raw_lines
+// when it cannot be parsed. The performance data is queued too when the
+// logPerform option is set in ctx.
+func SaveLog(
+	ctx context.Context,
+	p parser.Parser,
+	source domain.LogSourceType,
+	line string,
+) {
+	logPerform, _ := ctx.Value(domain.CtxKeyType("logPerform")).(bool)
+	saveLine(p, source, line, logPerform, lineAck{})
+}
+
+func saveLine(
+	p parser.Parser,
+	source domain.LogSourceType,
+	line string,
+	logPerform bool,
+	ack lineAck,
+) {
+	log, err := p.Parse(line)
 	if err != nil {
+		counters.unparsed.Add(1)
+		pushRawLine(source, line, ack)
 		return
 	}
-	GeneralChanPush(log)
+	counters.parsed.Add(1)
+	pushGeneralLog(log, source, ack)
 
 	if logPerform {
 		logPerformanceInfo, err := utils.GetPerformanceLogInfo(log)
@@ -113,75 +166,28 @@ func SaveLog(ctx context.Context, line string) {
 	}
 }
 
-func insertBatchPerformanceLog(
-	ctx context.Context,
-	db *sql.DB,
-	batch *[]domain.LogChanDataType,
-) {
-
-	query := `
-		INSERT INTO performance_logs 
-		(trace_id, method, exectime, memory_mb, timestamp)
-		VALUES 
-	`
-	queryValues := []string{}
-	params := []any{}
-	for _, log := range *batch {
-		params = append(params, log.Params...)
-		queryValues = append(queryValues, "(?, ?, ?, ?, ?)")
+// rowsOf returns the rows of a batch, as the sink inserts them.
+func rowsOf[T any](batch []queuedRow[T]) []T {
+	rows := make([]T, len(batch))
+	for i, queued := range batch {
+		rows[i] = queued.row
 	}
-	query += strings.Join(queryValues, ", ")
 
-	_, err := db.ExecContext(
-		ctx,
-		query,
-		params...,
-	)
-	if err != nil {
-		log.Printf("Error inserting performance log data: %s", err)
-	} else {
-		fmt.Printf("\r[Performance] Saved data: BatchSize=%d", len(*batch))
-	}
-	*batch = (*batch)[:0]
+	return rows
 }
 
-func insertBatchGeneralLog(
-	ctx context.Context,
-	db *sql.DB,
-	batch *[]domain.LogType,
-) {
-
-	query := `
-		INSERT INTO general_logs
-		(level, timestamp, hostname, trace_id, span_id, parent_id, msg)
-		VALUES 
-	`
-	queryValues := []string{}
-	params := []any{}
-	for _, log := range *batch {
-		params = append(
-			params,
-			log.Level,
-			log.Timestamp,
-			log.Hostname,
-			log.TraceId,
-			log.SpanId,
-			log.ParentId,
-			log.Msg,
-		)
-		queryValues = append(queryValues, "(?, ?, ?, ?, ?, ?, ?)")
+// ackRows tells the streams of the batch whether their lines were stored.
+func ackRows[T any](batch []queuedRow[T], ok bool) {
+	for _, queued := range batch {
+		queued.ack.ack(ok)
 	}
-	query += strings.Join(queryValues, ", ")
+}
 
-	_, err := db.ExecContext(
-		ctx,
-		query,
-		params...,
-	)
+// countStored adds the rows of a general or raw batch to the summary.
+func countStored(err error, rows int) {
 	if err != nil {
-		log.Printf("Error inserting general log data: %s", err)
+		counters.failed.Add(int64(rows))
 	} else {
-		fmt.Printf("\r[General] Saved data: BatchSize=%d", len(*batch))
+		counters.stored.Add(int64(rows))
 	}
-	*batch = (*batch)[:0]
 }
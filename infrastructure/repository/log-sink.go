@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/db"
+)
+
+// maxRowsPerInsert caps the rows of one INSERT. Bigger statements take
+// longer to prepare without inserting noticeably faster.
+const maxRowsPerInsert = 500
+
+// LogSink persists the batches of the writers. Each call stores the whole
+// batch or fails; the batch is not kept by the sink after returning.
+// Close is called once the writers finished.
+type LogSink interface {
+	InsertPerformanceLogs(ctx context.Context, batch []domain.LogChanDataType) error
+	InsertGeneralLogs(ctx context.Context, batch []domain.GeneralLogRecordType) error
+	InsertRawLines(ctx context.Context, batch []domain.RawLineType) error
+	Close() error
+}
+
+// sqliteSink writes each batch in the log.db of a Store inside a single
+// transaction, with prepared multi-row INSERT statements that are reused
+// between batches.
+type sqliteSink struct {
+	db          *sql.DB
+	performance *sqliteInsert
+	general     *sqliteInsert
+	raw         *sqliteInsert
+}
+
+// NewSQLiteSink returns the sink of the SQLite database of store. Closing
+// the store is left to its owner.
+func NewSQLiteSink(store *db.Store) LogSink {
+	limit := store.VariableLimit()
+	return &sqliteSink{
+		db: store.DB(),
+		performance: newSqliteInsert("performance_logs", limit, []string{
+			"trace_id", "method", "exectime", "memory_mb", "timestamp",
+		}),
+		general: newSqliteInsert("general_logs", limit, []string{
+			"level", "timestamp", "hostname", "trace_id", "span_id", "parent_id", "msg",
+			"cluster", "pod", "namespace", "container", "node", "source_file", "line_offset", "restart_count",
+		}),
+		raw: newSqliteInsert("raw_lines", limit, []string{
+			"cluster", "pod", "namespace", "container", "node", "file", "line_number", "restart_count",
+			"ingest_time", "timestamp", "text",
+		}),
+	}
+}
+
+func (s *sqliteSink) InsertPerformanceLogs(ctx context.Context, batch []domain.LogChanDataType) error {
+	return s.insert(ctx, s.performance, len(batch), func(i int, params []any) []any {
+		return append(params, batch[i].Params...)
+	})
+}
+
+func (s *sqliteSink) InsertGeneralLogs(ctx context.Context, batch []domain.GeneralLogRecordType) error {
+	return s.insert(ctx, s.general, len(batch), func(i int, params []any) []any {
+		log := batch[i]
+		return append(
+			params,
+			log.Level,
+			log.Timestamp,
+			log.Hostname,
+			log.TraceId,
+			log.SpanId,
+			log.ParentId,
+			log.Msg,
+			log.Source.Cluster,
+			log.Source.Pod,
+			log.Source.Namespace,
+			log.Source.Container,
+			log.Source.Node,
+			log.Source.File,
+			log.Source.Line,
+			log.Source.Restart,
+		)
+	})
+}
+
+func (s *sqliteSink) InsertRawLines(ctx context.Context, batch []domain.RawLineType) error {
+	return s.insert(ctx, s.raw, len(batch), func(i int, params []any) []any {
+		rawLine := batch[i]
+		var timestamp any
+		if rawLine.Timestamp != "" {
+			timestamp = rawLine.Timestamp
+		}
+		return append(
+			params,
+			rawLine.Source.Cluster,
+			rawLine.Source.Pod,
+			rawLine.Source.Namespace,
+			rawLine.Source.Container,
+			rawLine.Source.Node,
+			rawLine.Source.File,
+			rawLine.Source.Line,
+			rawLine.Source.Restart,
+			rawLine.IngestTime.Format(time.RFC3339Nano),
+			timestamp,
+			rawLine.Text,
+		)
+	})
+}
+
+// insert writes rows rows of table in one transaction: as many full
+// chunks as possible with the multi-row statement, and the rest one row
+// at a time. values appends the parameters of row i to params.
+func (s *sqliteSink) insert(
+	ctx context.Context,
+	table *sqliteInsert,
+	rows int,
+	values func(i int, params []any) []any,
+) error {
+	if rows == 0 {
+		return nil
+	}
+	chunkStmt, rowStmt, err := table.statements(ctx, s.db)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	chunk := tx.StmtContext(ctx, chunkStmt)
+	defer chunk.Close()
+	row := tx.StmtContext(ctx, rowStmt)
+	defer row.Close()
+
+	params := make([]any, 0, table.chunkRows*len(table.columns))
+	for start := 0; start < rows; {
+		stmt, end := row, start+1
+		if rows-start >= table.chunkRows {
+			stmt, end = chunk, start+table.chunkRows
+		}
+		params = params[:0]
+		for i := start; i < end; i++ {
+			params = values(i, params)
+		}
+		if _, err := stmt.ExecContext(ctx, params...); err != nil {
+			return fmt.Errorf("error insertando en %s: %w", table.name, err)
+		}
+		start = end
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteSink) Close() error {
+	// El store se cierra aparte: lo comparten los checkpoints y las consultas
+	return errors.Join(s.performance.close(), s.general.close(), s.raw.close())
+}
+
+// sqliteInsert holds the prepared INSERT statements of a table: one of
+// chunkRows rows, as many as fit in the SQLite variable limit, and one of
+// a single row for the remainder of a batch.
+type sqliteInsert struct {
+	name      string
+	columns   []string
+	chunkRows int
+
+	mu    sync.Mutex
+	chunk *sql.Stmt
+	row   *sql.Stmt
+}
+
+func newSqliteInsert(name string, variableLimit int, columns []string) *sqliteInsert {
+	return &sqliteInsert{
+		name:      name,
+		columns:   columns,
+		chunkRows: max(min(variableLimit/len(columns), maxRowsPerInsert), 1),
+	}
+}
+
+// statements prepares the statements on first use.
+func (t *sqliteInsert) statements(ctx context.Context, conn *sql.DB) (*sql.Stmt, *sql.Stmt, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.chunk == nil {
+		stmt, err := conn.PrepareContext(ctx, t.query(t.chunkRows))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error preparando insert de %s: %w", t.name, err)
+		}
+		t.chunk = stmt
+	}
+	if t.row == nil {
+		stmt, err := conn.PrepareContext(ctx, t.query(1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error preparando insert de %s: %w", t.name, err)
+		}
+		t.row = stmt
+	}
+
+	return t.chunk, t.row, nil
+}
+
+func (t *sqliteInsert) query(rows int) string {
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(t.columns)), ", ") + ")"
+	values := make([]string, rows)
+	for i := range values {
+		values[i] = placeholders
+	}
+
+	return "INSERT INTO " + t.name + " (" + strings.Join(t.columns, ", ") + ") VALUES " + strings.Join(values, ", ")
+}
+
+func (t *sqliteInsert) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var errs []error
+	for _, stmt := range []*sql.Stmt{t.chunk, t.row} {
+		if stmt != nil {
+			errs = append(errs, stmt.Close())
+		}
+	}
+	t.chunk, t.row = nil, nil
+
+	return errors.Join(errs...)
+}
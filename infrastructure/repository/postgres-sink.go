@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/db"
+)
+
+// postgresSink writes the batches in a shared PostgreSQL database with
+// COPY, which is much cheaper than INSERT for large batches.
+type postgresSink struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresSink connects to the database of dsn, creating the tables
+// when missing.
+func NewPostgresSink(ctx context.Context, dsn string) (LogSink, error) {
+	pool, err := db.OpenPostgres(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postgresSink{pool: pool}, nil
+}
+
+func (s *postgresSink) Close() error {
+	s.pool.Close()
+	return nil
+}
+
+func (s *postgresSink) InsertPerformanceLogs(ctx context.Context, batch []domain.LogChanDataType) error {
+	return s.copy(ctx, "performance_logs", len(batch), func(i int) []any {
+		return performanceRow(batch[i])
+	})
+}
+
+func (s *postgresSink) InsertGeneralLogs(ctx context.Context, batch []domain.GeneralLogRecordType) error {
+	return s.copy(ctx, "general_logs", len(batch), func(i int) []any {
+		return generalLogRow(batch[i])
+	})
+}
+
+func (s *postgresSink) InsertRawLines(ctx context.Context, batch []domain.RawLineType) error {
+	return s.copy(ctx, "raw_lines", len(batch), func(i int) []any {
+		return rawLineRow(batch[i])
+	})
+}
+
+// copy writes rows rows of table with a single COPY.
+func (s *postgresSink) copy(ctx context.Context, table string, rows int, values func(i int) []any) error {
+	_, err := s.pool.CopyFrom(
+		ctx,
+		pgx.Identifier{table},
+		db.LogColumns(table),
+		pgx.CopyFromSlice(rows, func(i int) ([]any, error) {
+			return values(i), nil
+		}),
+	)
+	return err
+}
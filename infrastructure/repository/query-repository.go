@@ -0,0 +1,317 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+)
+
+// QueryGeneralLogs runs filter against general_logs ordered by timestamp,
+// or by source with filter.SourceOrder, and calls each for every matching
+// row. Rows are streamed, so the whole result never has to fit in
+// memory.
+func QueryGeneralLogs(
+	ctx context.Context,
+	db *sql.DB,
+	filter domain.LogFilter,
+	each func(domain.GeneralLogRecordType) error,
+) error {
+	query, params := buildGeneralLogQuery(filter)
+
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return fmt.Errorf("error consultando general_logs: %w", err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		item, err := scanGeneralLog(rows)
+		if err != nil {
+			return err
+		}
+
+		// SQLite has no REGEXP by default, so the regex is applied here.
+		if filter.MsgRegex != nil && !filter.MsgRegex.MatchString(item.Msg) {
+			continue
+		}
+
+		if err := each(item); err != nil {
+			return err
+		}
+
+		count++
+		if filter.Limit > 0 && count >= filter.Limit {
+			break
+		}
+	}
+
+	return rows.Err()
+}
+
+// generalLogColumns are the general_logs columns read by scanGeneralLog.
+// The CAST keeps the driver from turning DATETIME columns into
+// time.Time, which drops any timestamp it cannot parse.
+const generalLogColumns = `
+	level, CAST(timestamp AS TEXT), hostname, trace_id, span_id, parent_id, msg,
+	cluster, pod, namespace, container, node, source_file, line_offset, restart_count
+`
+
+// scanGeneralLog reads a row selected with generalLogColumns, followed by
+// the extra columns of the query.
+func scanGeneralLog(rows *sql.Rows, extra ...any) (domain.GeneralLogRecordType, error) {
+	var level, timestamp, hostname, traceId, spanId, parentId, msg sql.NullString
+	var cluster, pod, namespace, container, node, sourceFile sql.NullString
+	var lineOffset, restartCount sql.NullInt64
+	dest := []any{
+		&level,
+		&timestamp,
+		&hostname,
+		&traceId,
+		&spanId,
+		&parentId,
+		&msg,
+		&cluster,
+		&pod,
+		&namespace,
+		&container,
+		&node,
+		&sourceFile,
+		&lineOffset,
+		&restartCount,
+	}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return domain.GeneralLogRecordType{}, fmt.Errorf("error leyendo general_logs: %w", err)
+	}
+
+	return domain.GeneralLogRecordType{
+		LogType: domain.LogType{
+			Level:     strings.TrimSpace(level.String),
+			Timestamp: timestamp.String,
+			Hostname:  hostname.String,
+			TraceId:   traceId.String,
+			SpanId:    spanId.String,
+			ParentId:  parentId.String,
+			Msg:       msg.String,
+		},
+		Source: domain.LogSourceType{
+			Cluster:   cluster.String,
+			Pod:       pod.String,
+			Namespace: namespace.String,
+			Container: container.String,
+			Node:      node.String,
+			File:      sourceFile.String,
+			Line:      int(lineOffset.Int64),
+			Restart:   int32(restartCount.Int64),
+		},
+	}, nil
+}
+
+func buildGeneralLogQuery(filter domain.LogFilter) (string, []any) {
+	query := "SELECT " + generalLogColumns + " FROM general_logs"
+	conditions, params := generalLogConditions(filter)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if filter.SourceOrder {
+		// NULL and '' are the same unknown source
+		query += " ORDER BY COALESCE(cluster, ''), COALESCE(namespace, ''), COALESCE(pod, ''), julianday(timestamp), id"
+	} else {
+		query += " ORDER BY julianday(timestamp), id"
+	}
+
+	// With a regex the limit is applied after filtering in Go.
+	if filter.Limit > 0 && filter.MsgRegex == nil {
+		query += " LIMIT ?"
+		params = append(params, filter.Limit)
+	}
+
+	return query, params
+}
+
+// generalLogConditions returns the WHERE conditions of filter for
+// general_logs and their parameters.
+func generalLogConditions(filter domain.LogFilter) ([]string, []any) {
+	conditions := []string{}
+	params := []any{}
+
+	if filter.Level != "" {
+		conditions = append(conditions, "UPPER(TRIM(level)) = UPPER(?)")
+		params = append(params, filter.Level)
+	}
+	if filter.TraceId != "" {
+		conditions = append(conditions, "trace_id = ?")
+		params = append(params, filter.TraceId)
+	}
+	if filter.Hostname != "" {
+		conditions = append(conditions, "hostname = ?")
+		params = append(params, filter.Hostname)
+	}
+	if filter.Cluster != "" {
+		conditions = append(conditions, "cluster = ?")
+		params = append(params, filter.Cluster)
+	}
+	if filter.Pod != "" {
+		conditions = append(conditions, "pod = ?")
+		params = append(params, filter.Pod)
+	}
+	if filter.Namespace != "" {
+		conditions = append(conditions, "namespace = ?")
+		params = append(params, filter.Namespace)
+	}
+	if filter.Container != "" {
+		conditions = append(conditions, "container = ?")
+		params = append(params, filter.Container)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "julianday(timestamp) >= julianday(?)")
+		params = append(params, filter.From.Format(time.RFC3339Nano))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "julianday(timestamp) <= julianday(?)")
+		params = append(params, filter.To.Format(time.RFC3339Nano))
+	}
+	if filter.Msg != "" {
+		conditions = append(conditions, `msg LIKE ? ESCAPE '\'`)
+		params = append(params, "%"+escapeLike(filter.Msg)+"%")
+	}
+
+	return conditions, params
+}
+
+func escapeLike(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(s)
+}
+
+// GetPerformanceByTrace returns the performance_logs rows of traceId
+// ordered by timestamp.
+func GetPerformanceByTrace(
+	ctx context.Context,
+	db *sql.DB,
+	traceId string,
+) ([]domain.PerformanceRecordType, error) {
+	rows, err := db.QueryContext(
+		ctx,
+		`
+		SELECT trace_id, method, exectime, memory_mb, CAST(timestamp AS TEXT)
+		FROM performance_logs
+		WHERE trace_id = ?
+		ORDER BY julianday(timestamp), id
+		`,
+		traceId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando performance_logs: %w", err)
+	}
+	defer rows.Close()
+
+	records := []domain.PerformanceRecordType{}
+	for rows.Next() {
+		var method, memoryUsage, timestamp sql.NullString
+		var exectime sql.NullFloat64
+		var record domain.PerformanceRecordType
+		if err := rows.Scan(
+			&record.TraceId,
+			&method,
+			&exectime,
+			&memoryUsage,
+			&timestamp,
+		); err != nil {
+			return nil, fmt.Errorf("error leyendo performance_logs: %w", err)
+		}
+		record.Method = method.String
+		record.Exectime = float32(exectime.Float64)
+		record.MemoryUsage = memoryUsage.String
+		record.Timestamp = timestamp.String
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// QueryPerformanceLogs calls each for every performance_logs row in the
+// time range and trace of filter, ordered by timestamp. performance_logs
+// has no source columns: with any other criteria of filter only the
+// traces with a matching general_logs row are returned.
+func QueryPerformanceLogs(
+	ctx context.Context,
+	db *sql.DB,
+	filter domain.LogFilter,
+	each func(domain.PerformanceRecordType) error,
+) error {
+	query := `
+		SELECT trace_id, method, exectime, memory_mb, CAST(timestamp AS TEXT)
+		FROM performance_logs
+	`
+	conditions := []string{}
+	params := []any{}
+	if filter.TraceId != "" {
+		conditions = append(conditions, "trace_id = ?")
+		params = append(params, filter.TraceId)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "julianday(timestamp) >= julianday(?)")
+		params = append(params, filter.From.Format(time.RFC3339Nano))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "julianday(timestamp) <= julianday(?)")
+		params = append(params, filter.To.Format(time.RFC3339Nano))
+	}
+
+	labels := domain.LogFilter{
+		Level:     filter.Level,
+		Hostname:  filter.Hostname,
+		Cluster:   filter.Cluster,
+		Pod:       filter.Pod,
+		Namespace: filter.Namespace,
+		Container: filter.Container,
+		Msg:       filter.Msg,
+	}
+	if labelConditions, labelParams := generalLogConditions(labels); len(labelConditions) > 0 {
+		conditions = append(
+			conditions,
+			"trace_id IN (SELECT trace_id FROM general_logs WHERE "+strings.Join(labelConditions, " AND ")+")",
+		)
+		params = append(params, labelParams...)
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY julianday(timestamp), id"
+
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return fmt.Errorf("error consultando performance_logs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var method, memoryUsage, timestamp sql.NullString
+		var exectime sql.NullFloat64
+		var record domain.PerformanceRecordType
+		if err := rows.Scan(
+			&record.TraceId,
+			&method,
+			&exectime,
+			&memoryUsage,
+			&timestamp,
+		); err != nil {
+			return fmt.Errorf("error leyendo performance_logs: %w", err)
+		}
+		record.Method = method.String
+		record.Exectime = float32(exectime.Float64)
+		record.MemoryUsage = memoryUsage.String
+		record.Timestamp = timestamp.String
+		if err := each(record); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
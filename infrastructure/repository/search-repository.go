@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmticonap/real-logs/domain"
+)
+
+// defaultSnippetTokens is the length of the snippets when the options do
+// not set one; FTS5 allows at most 64 tokens.
+const defaultSnippetTokens = 16
+
+// ErrNoFullTextSearch is returned by SearchGeneralLogs when SQLite was
+// compiled without FTS5, which go-sqlite3 only includes with the
+// sqlite_fts5 build tag.
+var ErrNoFullTextSearch = errors.New("la búsqueda necesita SQLite con FTS5: compile con -tags sqlite_fts5 (make build)")
+
+// SearchGeneralLogs runs the full-text query of options against the
+// messages of general_logs and calls each for every hit, the most
+// relevant first. The rest of filter narrows the hits like in
+// QueryGeneralLogs. The database must have been opened by a Store with
+// FullTextSearch; without FTS5 it returns ErrNoFullTextSearch.
+func SearchGeneralLogs(
+	ctx context.Context,
+	db *sql.DB,
+	filter domain.LogFilter,
+	options domain.SearchOptionsType,
+	each func(domain.SearchResultType) error,
+) error {
+	var enabled bool
+	if err := db.QueryRowContext(ctx, "SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); err != nil {
+		return fmt.Errorf("error consultando soporte de FTS5: %w", err)
+	}
+	if !enabled {
+		return ErrNoFullTextSearch
+	}
+
+	query, params := buildSearchQuery(filter, options)
+
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return fmt.Errorf("error buscando en general_logs: %w", err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var snippet sql.NullString
+		var rank sql.NullFloat64
+		item, err := scanGeneralLog(rows, &snippet, &rank)
+		if err != nil {
+			return err
+		}
+
+		if filter.MsgRegex != nil && !filter.MsgRegex.MatchString(item.Msg) {
+			continue
+		}
+
+		result := domain.SearchResultType{
+			GeneralLogRecordType: item,
+			Snippet:              snippet.String,
+			Rank:                 rank.Float64,
+		}
+		if err := each(result); err != nil {
+			return err
+		}
+
+		count++
+		if filter.Limit > 0 && count >= filter.Limit {
+			break
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error buscando en general_logs: %w", err)
+	}
+
+	return nil
+}
+
+func buildSearchQuery(filter domain.LogFilter, options domain.SearchOptionsType) (string, []any) {
+	tokens := options.SnippetTokens
+	if tokens <= 0 {
+		tokens = defaultSnippetTokens
+	}
+	tokens = min(tokens, 64)
+
+	// snippet() only works in the query that runs MATCH, so the hits
+	// are found first and joined with their rows afterwards.
+	query := "SELECT " + generalLogColumns + `, hit.snippet, hit.rank
+		FROM (
+			SELECT rowid, snippet(general_logs_fts, 0, ?, ?, '…', ?) AS snippet, rank
+			FROM general_logs_fts
+			WHERE general_logs_fts MATCH ?
+		) AS hit
+		JOIN general_logs ON general_logs.id = hit.rowid
+	`
+	params := []any{options.HighlightStart, options.HighlightEnd, tokens, options.Query}
+
+	conditions, conditionParams := generalLogConditions(filter)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+		params = append(params, conditionParams...)
+	}
+	query += " ORDER BY hit.rank, julianday(timestamp), general_logs.id"
+
+	if filter.Limit > 0 && filter.MsgRegex == nil {
+		query += " LIMIT ?"
+		params = append(params, filter.Limit)
+	}
+
+	return query, params
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmticonap/real-logs/domain"
+)
+
+// sinkValues cleans in place the text values of a row for the Postgres
+// and DuckDB sinks, which reject what SQLite stores as is.
+func sinkValues(row []any) []any {
+	for i, value := range row {
+		if text, ok := value.(string); ok {
+			row[i] = sinkText(text)
+		}
+	}
+
+	return row
+}
+
+// sinkText drops the NUL bytes and replaces the invalid UTF-8 of value,
+// so a binary line read from a container does not fail its whole batch.
+func sinkText(value string) string {
+	if strings.IndexByte(value, 0) >= 0 {
+		value = strings.ReplaceAll(value, "\x00", "")
+	}
+	if !utf8.ValidString(value) {
+		value = strings.ToValidUTF8(value, "\uFFFD")
+	}
+
+	return value
+}
+
+// sinkTimestamp converts a text timestamp of the parsers for a timestamp
+// column. A value that is not RFC3339 goes to the timestamp_text column
+// instead, so it is not lost; an empty one is NULL in both.
+func sinkTimestamp(value string) (timestamp any, text any) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, value
+	}
+
+	return t, nil
+}
+
+// performanceRow is the row of performance_logs for item, in the order
+// of db.LogColumns.
+func performanceRow(item domain.LogChanDataType) []any {
+	row := append([]any{}, item.Params...)
+	var text any
+	// El timestamp llega como texto RFC3339
+	if timestamp, ok := row[4].(string); ok {
+		row[4], text = sinkTimestamp(timestamp)
+	}
+
+	return sinkValues(append(row, text))
+}
+
+// generalLogRow is the row of general_logs for log, in the order of
+// db.LogColumns.
+func generalLogRow(log domain.GeneralLogRecordType) []any {
+	timestamp, text := sinkTimestamp(log.Timestamp)
+	return sinkValues([]any{
+		log.Level,
+		timestamp,
+		log.Hostname,
+		log.TraceId,
+		log.SpanId,
+		log.ParentId,
+		log.Msg,
+		log.Source.Cluster,
+		log.Source.Pod,
+		log.Source.Namespace,
+		log.Source.Container,
+		log.Source.Node,
+		log.Source.File,
+		log.Source.Line,
+		log.Source.Restart,
+		text,
+	})
+}
+
+// rawLineRow is the row of raw_lines for rawLine, in the order of
+// db.LogColumns.
+func rawLineRow(rawLine domain.RawLineType) []any {
+	timestamp, text := sinkTimestamp(rawLine.Timestamp)
+	return sinkValues([]any{
+		rawLine.Source.Cluster,
+		rawLine.Source.Pod,
+		rawLine.Source.Namespace,
+		rawLine.Source.Container,
+		rawLine.Source.Node,
+		rawLine.Source.File,
+		rawLine.Source.Line,
+		rawLine.Source.Restart,
+		rawLine.IngestTime,
+		timestamp,
+		rawLine.Text,
+		text,
+	})
+}
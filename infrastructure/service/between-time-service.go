@@ -4,109 +4,251 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"log"
-	"os"
-	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/parser"
 	"github.com/jmticonap/real-logs/infrastructure/repository"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
-func BetweenTimesProcess(ctx context.Context, cfg *domain.Config, startTime, endTime time.Time) {
-	clientset, err := GetKubernetesClient()
-	if err != nil {
-		log.Fatalf("Error al obtener el cliente de Kubernetes: %v", err)
-	}
+// defaultDownloadWorkers is the number of containers downloaded at the
+// same time when DownloadOptionsType.Workers is not set.
+const defaultDownloadWorkers = 4
+
+// containerDownload is one container whose logs are downloaded.
+type containerDownload struct {
+	parser parser.Parser
+	source domain.LogSourceType
+}
+
+// downloadResult is the outcome of a containerDownload.
+type downloadResult struct {
+	source  domain.LogSourceType
+	lines   int
+	skipped int
+	bytes   int64
+	elapsed time.Duration
+	err     error
+}
 
-	pods, err := getPodsByLabel(clientset, cfg)
+// BetweenTimesProcess downloads the logs written between startTime and
+// endTime by every pod selected by cfg, using clientset to reach the cluster.
+// Containers are downloaded in parallel by options.Workers workers and the
+// progress of each one is reported as it ends. An error is returned only
+// when the pods cannot be listed or the log directory created; the failed
+// containers are reported with the progress.
+func BetweenTimesProcess(
+	ctx context.Context,
+	clientset kubernetes.Interface,
+	cfg *domain.Config,
+	parsers *parser.Registry,
+	startTime, endTime time.Time,
+	options domain.DownloadOptionsType,
+) error {
+	pods, err := getPodsByLabel(ctx, clientset, cfg)
 	if err != nil {
-		log.Fatalf("Error al obtener pods: %v", err)
+		return fmt.Errorf("error al obtener pods: %w", err)
 	}
 
-	logDir := filepath.Join("logs", time.Now().Format("2006-01-02_15-04-05"))
-	if err := os.MkdirAll(logDir, os.ModePerm); err != nil {
-		log.Fatalf("No se pudo crear directorio para logs: %v", err)
+	logDir, err := getOutputDir(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("no se pudo crear directorio para logs: %w", err)
 	}
 
+	downloads := []containerDownload{}
 	for _, pod := range pods {
-		fmt.Printf("Procesando logs para pod %s...\n", pod.Name)
-
-		req := clientset.CoreV1().Pods(cfg.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
-			SinceTime: &metav1.Time{Time: startTime},
-			Follow:    false,
-		})
-
-		stream, err := req.Stream(ctx)
-		if err != nil {
-			log.Printf("Error al obtener logs del pod %s: %v", pod.Name, err)
-			continue
+		p := parsers.ForLabels(pod.Labels)
+		for _, container := range selectContainers(&pod, cfg.Containers) {
+			downloads = append(downloads, containerDownload{
+				parser: p,
+				source: domain.LogSourceType{
+					Cluster:   cfg.Cluster,
+					Pod:       pod.Name,
+					Namespace: pod.Namespace,
+					Container: container.Name,
+					Node:      pod.Spec.NodeName,
+				},
+			})
 		}
-		defer stream.Close()
+	}
 
-		logFile := filepath.Join(logDir, fmt.Sprintf("%s.log", pod.Name))
-		f, err := os.Create(logFile)
-		if err != nil {
-			log.Printf("No se pudo crear archivo de logs para %s: %v", pod.Name, err)
-			continue
-		}
-		defer f.Close()
-
-		scanner := bufio.NewScanner(stream)
-		for scanner.Scan() {
-			line := scanner.Text()
-			logTime, err := extractTimestamp(line)
-			if err != nil {
-				log.Printf("No se pudo parsear la línea: %s", line)
-				continue
+	workers := options.Workers
+	if workers <= 0 {
+		workers = defaultDownloadWorkers
+	}
+	workers = min(workers, max(len(downloads), 1))
+	log.Printf("Descargando %d contenedores de %d pods con %d workers", len(downloads), len(pods), workers)
+
+	jobs := make(chan containerDownload)
+	results := make(chan downloadResult)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results <- downloadContainerLogs(ctx, clientset, job.parser, logDir, job.source, startTime, endTime, options)
 			}
-			if logTime.After(endTime) {
-				break
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, job := range downloads {
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
 			}
-			f.WriteString(line + "\n")
-			go repository.SaveLog(ctx, line)
 		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	start := time.Now()
+	var done, failed, lines, skipped int
+	var bytes int64
+	for result := range results {
+		done++
+		name := result.source.Pod + "/" + result.source.Container
+		if result.err != nil {
+			failed++
+			log.Printf("[%d/%d] Error al obtener logs del pod %s: %v", done, len(downloads), name, result.err)
+		} else {
+			log.Printf(
+				"[%d/%d] %s: %d líneas, %d bytes, %d fuera de rango (%s)",
+				done,
+				len(downloads),
+				name,
+				result.lines,
+				result.bytes,
+				result.skipped,
+				result.elapsed.Round(time.Millisecond),
+			)
+		}
+		lines += result.lines
+		skipped += result.skipped
+		bytes += result.bytes
 	}
+
+	log.Printf(
+		"Total: %d pods, %d contenedores, %d errores, %d líneas, %d bytes, %d fuera de rango en %s",
+		len(pods),
+		done,
+		failed,
+		lines,
+		bytes,
+		skipped,
+		time.Since(start).Round(time.Millisecond),
+	)
+
+	return nil
 }
 
-func getPodsByLabel(clientset *kubernetes.Clientset, cfg *domain.Config) ([]corev1.Pod, error) {
-	podList, err := clientset.CoreV1().Pods(cfg.Namespace).List(context.TODO(), metav1.ListOptions{
-		LabelSelector: cfg.LabelSelector,
-	})
-	if err != nil {
-		return nil, err
+// downloadContainerLogs writes the logs of one pod container between
+// startTime and endTime into a file of logDir named after the range, and
+// queues them for the database.
+// The range is checked with the timestamp the kubelet adds to each line,
+// which is always increasing, so lines without their own timestamp (stack
+// traces, banners) or with out of order ones are kept, and the download
+// stops at the first line after endTime.
+func downloadContainerLogs(
+	ctx context.Context,
+	clientset kubernetes.Interface,
+	p parser.Parser,
+	logDir string,
+	source domain.LogSourceType,
+	startTime, endTime time.Time,
+	options domain.DownloadOptionsType,
+) downloadResult {
+	started := time.Now()
+	result := downloadResult{source: source}
+	logOptions := &corev1.PodLogOptions{
+		Container:  source.Container,
+		SinceTime:  &metav1.Time{Time: startTime},
+		Timestamps: true,
+	}
+	if options.LimitBytes > 0 {
+		logOptions.LimitBytes = &options.LimitBytes
+	}
+	if options.TailLines > 0 {
+		logOptions.TailLines = &options.TailLines
 	}
 
-	return podList.Items, nil
-}
+	stream, err := clientset.CoreV1().Pods(source.Namespace).GetLogs(source.Pod, logOptions).Stream(ctx)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	defer stream.Close()
 
-func extractTimestamp(logLine string) (time.Time, error) {
-	for _, r := range domain.TimeRegexes {
-		if match := r.FindStringSubmatch(logLine); match != nil {
-			return parseTimestamp(match[1])
-		} else {
-			log.Printf("No se pudo parsear la línea: %s", logLine)
+	f, filename, err := createRangeLog(ctx, logDir, source.Pod, source.Container, startTime, endTime)
+	if err != nil {
+		result.err = fmt.Errorf("no se pudo crear archivo de logs: %w", err)
+		return result
+	}
+	defer f.Close()
+	source.File = filename
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lineTime, line, hasTime := splitKubeletTimestamp(scanner.Text())
+		if hasTime && lineTime.Before(startTime) {
+			// TailLines puede traer líneas anteriores a startTime
+			result.skipped++
+			continue
 		}
+		if hasTime && lineTime.After(endTime) {
+			break
+		}
+		source.Line++
+		if _, err := io.WriteString(f, line+"\n"); err != nil {
+			result.err = fmt.Errorf("error escribiendo log: %w", err)
+			break
+		}
+		result.lines++
+		result.bytes += int64(len(line)) + 1
+		repository.IngestPush(ctx, p, source, line)
+	}
+	if result.err == nil {
+		result.err = scanner.Err()
 	}
-	return time.Time{}, fmt.Errorf("no timestamp found")
+	result.elapsed = time.Since(started)
+
+	return result
 }
 
-func parseTimestamp(s string) (time.Time, error) {
-	formats := []string{
-		time.RFC3339,                    // "2025-05-15T17:22:59-05:00"
-		"2006-01-02T15:04:05Z0700",      // "2025-05-15T17:22:59-0500"
-		"2006-01-02T15:04:05.000Z0700",  // "2025-05-15T17:22:59.820-0500"
-		"2006-01-02T15:04:05.000Z07:00", // "2025-05-15T17:22:59.820-05:00"
+// getPodsByLabel lists the pods of every namespace of cfg that match the
+// label selector and the pod filter.
+func getPodsByLabel(ctx context.Context, clientset kubernetes.Interface, cfg *domain.Config) ([]corev1.Pod, error) {
+	matcher, err := newPodMatcher(cfg.Pods)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, layout := range formats {
-		if t, err := time.Parse(layout, s); err == nil {
-			return t, nil
+	pods := []corev1.Pod{}
+	for _, namespace := range targetNamespaces(cfg) {
+		podList, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: getLabelSelector(ctx, cfg),
+			FieldSelector: cfg.Pods.FieldSelector,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("namespace %q: %w", namespace, err)
+		}
+		for _, pod := range podList.Items {
+			if matcher.matches(&pod) {
+				pods = append(pods, pod)
+			}
 		}
 	}
 
-	return time.Time{}, fmt.Errorf("invalid timestamp format: %s", s)
+	return pods, nil
 }
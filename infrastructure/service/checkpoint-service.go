@@ -0,0 +1,75 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+)
+
+// checkpointInterval is how often the position of a stream is saved.
+const checkpointInterval = 2 * time.Second
+
+// streamRetryMin and streamRetryMax bound the backoff between the
+// reconnections of a stream.
+const (
+	streamRetryMin = time.Second
+	streamRetryMax = 30 * time.Second
+)
+
+// streamResume tracks the position of a container stream. When resumed
+// from a checkpoint, SinceTime only has second precision, so the lines
+// of the overlap window that were already read are dropped.
+type streamResume struct {
+	checkpoint      domain.StreamCheckpointType
+	skipAtTimestamp int
+}
+
+func newStreamResume(checkpoint domain.StreamCheckpointType) *streamResume {
+	return &streamResume{
+		checkpoint:      checkpoint,
+		skipAtTimestamp: checkpoint.LinesAtTimestamp,
+	}
+}
+
+// accept reports whether a line with timestamp t is new, and moves the
+// checkpoint forward when it is. Lines without timestamp are always new.
+func (r *streamResume) accept(t time.Time, hasTimestamp bool) bool {
+	if !hasTimestamp {
+		return true
+	}
+
+	last := r.checkpoint.LastTimestamp
+	switch {
+	case !last.IsZero() && t.Before(last):
+		return false
+	case t.Equal(last):
+		if r.skipAtTimestamp > 0 {
+			r.skipAtTimestamp--
+			return false
+		}
+		r.checkpoint.LinesAtTimestamp++
+	default:
+		r.checkpoint.LastTimestamp = t
+		r.checkpoint.LinesAtTimestamp = 1
+		r.skipAtTimestamp = 0
+	}
+
+	return true
+}
+
+// splitKubeletTimestamp separates the RFC3339 timestamp the kubelet adds
+// to every line when PodLogOptions.Timestamps is set.
+func splitKubeletTimestamp(raw string) (time.Time, string, bool) {
+	prefix, line, found := strings.Cut(raw, " ")
+	if !found {
+		prefix = raw
+		line = ""
+	}
+	t, err := time.Parse(time.RFC3339Nano, prefix)
+	if err != nil {
+		return time.Time{}, raw, false
+	}
+
+	return t, line, true
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 
 	"github.com/jmticonap/real-logs/domain"
@@ -20,3 +21,71 @@ func LoadConfig(path string) (*domain.Config, error) {
 
 	return &cfg, nil
 }
+
+// SplitTargets returns one Config per target of cfg, with the connection
+// fields of the target and the rest taken from cfg. Without targets it
+// returns cfg itself.
+func SplitTargets(cfg *domain.Config) []*domain.Config {
+	if len(cfg.Targets) == 0 {
+		return []*domain.Config{cfg}
+	}
+
+	configs := []*domain.Config{}
+	for _, target := range cfg.Targets {
+		targetCfg := *cfg
+		targetCfg.Targets = nil
+		targetCfg.Cluster = target.Name
+		if targetCfg.Cluster == "" {
+			targetCfg.Cluster = target.Context
+		}
+		if target.Kubeconfig != "" {
+			targetCfg.Kubeconfig = target.Kubeconfig
+		}
+		if target.Context != "" {
+			targetCfg.Context = target.Context
+		}
+		if target.Namespace != "" || len(target.Namespaces) > 0 {
+			targetCfg.Namespace = target.Namespace
+			targetCfg.Namespaces = target.Namespaces
+		}
+		if target.LabelSelector != "" {
+			targetCfg.LabelSelector = target.LabelSelector
+		}
+		configs = append(configs, &targetCfg)
+	}
+
+	return configs
+}
+
+// SetNamespaces applies the namespaces of the -namespace flag to cfg and
+// to every target, since the flag wins over the namespaces of the config
+// file.
+func SetNamespaces(cfg *domain.Config, namespaces []string) {
+	cfg.Namespace = ""
+	cfg.Namespaces = namespaces
+	for i := range cfg.Targets {
+		cfg.Targets[i].Namespace = ""
+		cfg.Targets[i].Namespaces = nil
+	}
+}
+
+// CheckStore validates the store selected for flow. The flows that read
+// the logs back (query, search, trace and export) only know the SQL of
+// the local log.db, so they reject the other stores instead of reading
+// a database the collectors did not write.
+func CheckStore(flow, store string) error {
+	switch store {
+	case "", domain.StoreSqlite:
+		return nil
+	case domain.StorePostgres, domain.StoreDuckdb:
+	default:
+		return fmt.Errorf("store desconocido: %s", store)
+	}
+
+	switch flow {
+	case domain.Query, domain.Search, domain.Trace, domain.Export:
+		return fmt.Errorf("el flujo %s solo lee el log.db local, no soporta -store=%s: consulte %s directamente", flow, store, store)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// podContainer is a container of a pod whose logs are collected.
+type podContainer struct {
+	Name string
+	Init bool
+}
+
+// selectContainers returns the init containers and containers of pod,
+// in that order, that pass filter.
+func selectContainers(pod *corev1.Pod, filter domain.ContainerFilterType) []podContainer {
+	containers := []podContainer{}
+	add := func(name string, init bool) {
+		if len(filter.Include) > 0 && !slices.Contains(filter.Include, name) {
+			return
+		}
+		if slices.Contains(filter.Exclude, name) {
+			return
+		}
+		containers = append(containers, podContainer{Name: name, Init: init})
+	}
+
+	for _, c := range pod.Spec.InitContainers {
+		add(c.Name, true)
+	}
+	for _, c := range pod.Spec.Containers {
+		add(c.Name, false)
+	}
+
+	return containers
+}
+
+// containerLogFile is the file where the logs of a pod container are
+// written: one file per pod and container.
+func containerLogFile(dir, podName, containerName string) string {
+	return filepath.Join(dir, fmt.Sprintf("%s_%s.log", podName, containerName))
+}
+
+// discardFile replaces the log file when only the database is written.
+type discardFile struct{}
+
+func (discardFile) Write(p []byte) (int, error) { return len(p), nil }
+func (discardFile) Close() error                { return nil }
+
+// rangeFileLayout formats the time range in the file names of btimes.
+const rangeFileLayout = "20060102T150405Z"
+
+// rangeLogFile is the file of a pod container downloaded by btimes, one
+// per time range so it is not mixed with the file of realtime.
+func rangeLogFile(dir, podName, containerName string, startTime, endTime time.Time) string {
+	return filepath.Join(dir, fmt.Sprintf(
+		"%s_%s_%s_%s.log",
+		podName,
+		containerName,
+		startTime.UTC().Format(rangeFileLayout),
+		endTime.UTC().Format(rangeFileLayout),
+	))
+}
+
+// openContainerLog opens the log file of a pod container in append mode
+// and returns its path. When the noFile option is set in ctx nothing is
+// written and the path is empty.
+func openContainerLog(ctx context.Context, dir, podName, containerName string) (io.WriteCloser, string, error) {
+	return openLogFile(ctx, containerLogFile(dir, podName, containerName), os.O_APPEND)
+}
+
+// createRangeLog creates the btimes file of a pod container, replacing
+// the one of a previous download of the same range.
+func createRangeLog(
+	ctx context.Context,
+	dir, podName, containerName string,
+	startTime, endTime time.Time,
+) (io.WriteCloser, string, error) {
+	return openLogFile(ctx, rangeLogFile(dir, podName, containerName, startTime, endTime), os.O_TRUNC)
+}
+
+func openLogFile(ctx context.Context, filename string, mode int) (io.WriteCloser, string, error) {
+	if noFile, _ := ctx.Value(domain.CtxKeyType("noFile")).(bool); noFile {
+		return discardFile{}, "", nil
+	}
+
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|mode, 0644)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return file, filename, nil
+}
+
+func streamKey(namespace, podName, containerName string) string {
+	return namespace + "/" + podName + "/" + containerName
+}
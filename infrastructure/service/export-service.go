@@ -0,0 +1,470 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/repository"
+	"github.com/jmticonap/real-logs/utils"
+	"github.com/parquet-go/parquet-go"
+)
+
+// unknownPartition holds the rows without the partition value, e.g. an
+// unparseable timestamp or a line read by fromdir.
+const unknownPartition = "unknown"
+
+// The export columns are the parquet columns of the rows, in the same
+// order. CSV uses them as header and NDJSON as keys, so the three formats
+// load with the same schema.
+var exportLogColumns = []string{
+	"level",
+	"timestamp",
+	"hostname",
+	"trace_id",
+	"span_id",
+	"parent_id",
+	"msg",
+	"cluster",
+	"pod",
+	"namespace",
+	"container",
+	"node",
+	"source_file",
+	"line_offset",
+	"restart_count",
+	"timestamp_text",
+}
+
+var exportPerformanceColumns = []string{
+	"trace_id",
+	"method",
+	"exectime",
+	"memory_mb",
+	"timestamp",
+	"timestamp_text",
+}
+
+// ExportProcess writes the general_logs and performance_logs rows that
+// match filter in options.Dir, one folder per table and one file per
+// partition: <dir>/general_logs/<hour>.<format> or
+// <dir>/general_logs/<cluster>/<namespace>/<pod>.<format>, so pods with the
+// same name in different clusters or namespaces are not mixed. Without
+// partition each table is a single file, <dir>/general_logs.<format>.
+// performance_logs has no pod, so it is only split by hour. filter.Limit
+// is ignored: it would cut general_logs short and leave performance_logs
+// whole.
+func ExportProcess(
+	ctx context.Context,
+	db *sql.DB,
+	filter domain.LogFilter,
+	options domain.ExportOptionsType,
+) error {
+	switch options.Format {
+	case domain.OutputParquet, domain.OutputNdjson, domain.OutputCsv:
+	default:
+		return fmt.Errorf("formato de exportación no soportado: %s", options.Format)
+	}
+	switch options.Partition {
+	case "", domain.PartitionHour, domain.PartitionPod:
+	default:
+		return fmt.Errorf("partición no soportada: %s", options.Partition)
+	}
+	if options.Location == nil {
+		options.Location = time.Local
+	}
+	if filter.Limit > 0 {
+		log.Printf("-limit no aplica al export, se exportan todas las filas")
+		filter.Limit = 0
+	}
+
+	// Los archivos se escriben de a uno: las filas llegan ordenadas por
+	// partición y cada archivo se cierra cuando termina la suya
+	filter.SourceOrder = options.Partition == domain.PartitionPod
+	logs := newExportTable("general_logs", exportLogColumns, options, logRecord)
+	err := repository.QueryGeneralLogs(ctx, db, filter, func(item domain.GeneralLogRecordType) error {
+		row := exportLogRow(item)
+		return logs.write(logPartition(row, options), row)
+	})
+	if err := logs.close(err); err != nil {
+		return err
+	}
+
+	performancePartition := func(row domain.ExportPerformanceRow) string {
+		if options.Partition == domain.PartitionHour {
+			return hourPartition(row.Timestamp, options.Location)
+		}
+		return ""
+	}
+	performance := newExportTable("performance_logs", exportPerformanceColumns, options, performanceRecord)
+	err = repository.QueryPerformanceLogs(ctx, db, filter, func(record domain.PerformanceRecordType) error {
+		row := exportPerformanceRow(record)
+		return performance.write(performancePartition(row), row)
+	})
+	return performance.close(err)
+}
+
+func logPartition(row domain.ExportLogRow, options domain.ExportOptionsType) string {
+	switch options.Partition {
+	case domain.PartitionHour:
+		return hourPartition(row.Timestamp, options.Location)
+	case domain.PartitionPod:
+		segments := []string{row.Cluster, row.Namespace, row.Pod}
+		for i, segment := range segments {
+			if segment == "" {
+				segments[i] = unknownPartition
+			}
+		}
+		return filepath.Join(segments...)
+	default:
+		return ""
+	}
+}
+
+// hourPartition names the hour of timestamp in loc, e.g. 2025-05-15T17.
+func hourPartition(timestamp time.Time, loc *time.Location) string {
+	if timestamp.IsZero() {
+		return unknownPartition
+	}
+
+	return timestamp.In(loc).Format("2006-01-02T15")
+}
+
+// exportTime parses the text timestamp of a row for the timestamp
+// column. A value that is not RFC3339 is returned as text instead, so it
+// is not lost.
+func exportTime(value string) (time.Time, string) {
+	if value == "" {
+		return time.Time{}, ""
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, value
+	}
+
+	return t, ""
+}
+
+// exportTimeText formats the timestamp column for CSV and NDJSON, in the
+// offset of the log.
+func exportTimeText(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339Nano)
+}
+
+func exportLogRow(item domain.GeneralLogRecordType) domain.ExportLogRow {
+	timestamp, text := exportTime(item.Timestamp)
+	return domain.ExportLogRow{
+		Level:         item.Level,
+		Timestamp:     timestamp,
+		Hostname:      item.Hostname,
+		TraceId:       item.TraceId,
+		SpanId:        item.SpanId,
+		ParentId:      item.ParentId,
+		Msg:           item.Msg,
+		Cluster:       item.Source.Cluster,
+		Pod:           item.Source.Pod,
+		Namespace:     item.Source.Namespace,
+		Container:     item.Source.Container,
+		Node:          item.Source.Node,
+		File:          item.Source.File,
+		Line:          item.Source.Line,
+		Restart:       item.Source.Restart,
+		TimestampText: text,
+	}
+}
+
+func exportPerformanceRow(record domain.PerformanceRecordType) domain.ExportPerformanceRow {
+	timestamp, text := exportTime(record.Timestamp)
+	return domain.ExportPerformanceRow{
+		TraceId:       record.TraceId,
+		Method:        record.Method,
+		Exectime:      record.Exectime,
+		MemoryUsage:   record.MemoryUsage,
+		Timestamp:     timestamp,
+		TimestampText: text,
+	}
+}
+
+func logRecord(row domain.ExportLogRow) []any {
+	return []any{
+		row.Level,
+		exportTimeText(row.Timestamp),
+		row.Hostname,
+		row.TraceId,
+		row.SpanId,
+		row.ParentId,
+		row.Msg,
+		row.Cluster,
+		row.Pod,
+		row.Namespace,
+		row.Container,
+		row.Node,
+		row.File,
+		row.Line,
+		row.Restart,
+		row.TimestampText,
+	}
+}
+
+func performanceRecord(row domain.ExportPerformanceRow) []any {
+	return []any{
+		row.TraceId,
+		row.Method,
+		row.Exectime,
+		row.MemoryUsage,
+		exportTimeText(row.Timestamp),
+		row.TimestampText,
+	}
+}
+
+// exportTable writes the files of a table one at a time: the rows come
+// ordered by partition, so the file of the current partition is closed
+// when the next one starts and a large cluster never holds a file per pod
+// open. A partition seen again, e.g. a timestamp SQLite orders but Go does
+// not parse, goes to a new file with a numeric suffix instead of
+// overwriting the first one.
+type exportTable[T any] struct {
+	name      string
+	columns   []string
+	options   domain.ExportOptionsType
+	record    func(T) []any
+	partition string
+	current   rowWriter[T]
+	parts     map[string]int
+	files     int
+	rows      int
+}
+
+func newExportTable[T any](
+	name string,
+	columns []string,
+	options domain.ExportOptionsType,
+	record func(T) []any,
+) *exportTable[T] {
+	return &exportTable[T]{
+		name:    name,
+		columns: columns,
+		options: options,
+		record:  record,
+		parts:   map[string]int{},
+	}
+}
+
+func (t *exportTable[T]) write(partition string, row T) error {
+	if t.current == nil || partition != t.partition {
+		if err := t.closeCurrent(); err != nil {
+			return err
+		}
+		if err := t.open(partition); err != nil {
+			return err
+		}
+	}
+	t.rows++
+
+	return t.current.Write(row)
+}
+
+func (t *exportTable[T]) open(partition string) error {
+	name := t.name
+	if partition != "" {
+		name = filepath.Join(t.name, partition)
+	}
+	if part := t.parts[partition]; part > 0 {
+		name = fmt.Sprintf("%s-%d", name, part)
+	}
+	path := filepath.Join(t.options.Dir, name+"."+t.options.Format)
+	if err := utils.EnsureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	w, err := newRowWriter(path, t.options.Format, t.columns, t.record)
+	if err != nil {
+		return err
+	}
+	t.parts[partition]++
+	t.files++
+	t.partition, t.current = partition, w
+
+	return nil
+}
+
+func (t *exportTable[T]) closeCurrent() error {
+	if t.current == nil {
+		return nil
+	}
+	w := t.current
+	t.current = nil
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error cerrando %s %s: %w", t.name, t.partition, err)
+	}
+
+	return nil
+}
+
+// close finishes the last file. err is the error of the query, returned
+// first so a failed export is not reported as complete.
+func (t *exportTable[T]) close(err error) error {
+	if cErr := t.closeCurrent(); cErr != nil && err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Exportadas %d filas de %s en %d archivos", t.rows, t.name, t.files)
+
+	return nil
+}
+
+// rowWriter writes the rows of one export file.
+type rowWriter[T any] interface {
+	Write(row T) error
+	Close() error
+}
+
+func newRowWriter[T any](path, format string, columns []string, record func(T) []any) (rowWriter[T], error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case domain.OutputParquet:
+		return &parquetWriter[T]{file: file, w: parquet.NewGenericWriter[T](file)}, nil
+	case domain.OutputCsv:
+		w := csv.NewWriter(file)
+		if err := w.Write(columns); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &csvWriter[T]{file: file, w: w, record: record}, nil
+	default:
+		buffer := bufio.NewWriter(file)
+		return &ndjsonWriter[T]{file: file, buffer: buffer, encoder: json.NewEncoder(buffer), columns: columns, record: record}, nil
+	}
+}
+
+type parquetWriter[T any] struct {
+	file io.WriteCloser
+	w    *parquet.GenericWriter[T]
+}
+
+func (p *parquetWriter[T]) Write(row T) error {
+	_, err := p.w.Write([]T{row})
+	return err
+}
+
+func (p *parquetWriter[T]) Close() error {
+	if err := p.w.Close(); err != nil {
+		p.file.Close()
+		return err
+	}
+
+	return p.file.Close()
+}
+
+type csvWriter[T any] struct {
+	file   io.WriteCloser
+	w      *csv.Writer
+	record func(T) []any
+}
+
+func (c *csvWriter[T]) Write(row T) error {
+	values := c.record(row)
+	fields := make([]string, len(values))
+	for i, value := range values {
+		fields[i] = csvField(value)
+	}
+
+	return c.w.Write(fields)
+}
+
+func csvField(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int32:
+		return strconv.Itoa(int(v))
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (c *csvWriter[T]) Close() error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		c.file.Close()
+		return err
+	}
+
+	return c.file.Close()
+}
+
+type ndjsonWriter[T any] struct {
+	file    io.WriteCloser
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+	columns []string
+	record  func(T) []any
+}
+
+func (n *ndjsonWriter[T]) Write(row T) error {
+	return n.encoder.Encode(ndjsonRow{columns: n.columns, values: n.record(row)})
+}
+
+// ndjsonRow is an object with every export column as key, in order and
+// including the empty values, so each line has the same schema.
+type ndjsonRow struct {
+	columns []string
+	values  []any
+}
+
+func (r ndjsonRow) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, column := range r.columns {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(r.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
+
+func (n *ndjsonWriter[T]) Close() error {
+	if err := n.buffer.Flush(); err != nil {
+		n.file.Close()
+		return err
+	}
+
+	return n.file.Close()
+}
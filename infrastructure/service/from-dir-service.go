@@ -3,43 +3,52 @@ package service
 import (
 	"bufio"
 	"context"
-	"log"
+	"fmt"
 	"os"
 
 	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/parser"
 	"github.com/jmticonap/real-logs/infrastructure/repository"
 	"github.com/jmticonap/real-logs/utils"
 )
 
-func FromDir(ctx context.Context, dirPath string) {
-	logPerform := ctx.Value(domain.CtxKeyType("logPerform")).(bool)
+// FromDir queues for ingestion every line of the files under dirPath. It
+// stops at the first file that cannot be read.
+func FromDir(ctx context.Context, p parser.Parser, dirPath string) error {
 	paths, err := utils.GetAllFilesRecursive(dirPath)
 	if err != nil {
-		log.Fatalf("Error reading dir: %s", err)
+		return fmt.Errorf("error leyendo el directorio: %w", err)
 	}
 
 	for _, path := range paths {
-		file, err := os.Open(path)
-		if err != nil {
-			log.Fatalf("Error openning file: %s", err)
+		if ctx.Err() != nil {
+			return nil
 		}
-		defer file.Close()
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := scanner.Text()
-			log, err := utils.GetLogItem(line)
-			if err != nil {
-				continue
-			}
-			repository.GeneralChanPush(log)
-
-			if logPerform {
-				logPerformanceInfo, err := utils.GetPerformanceLogInfo(log)
-				if err != nil {
-					continue
-				}
-				repository.LogChanPush(log, logPerformanceInfo)
-			}
+		if err := loadFile(ctx, p, path); err != nil {
+			return fmt.Errorf("error leyendo %s: %w", path, err)
 		}
 	}
+
+	return nil
+}
+
+// loadFile queues every line of the file at path for ingestion.
+func loadFile(ctx context.Context, p parser.Parser, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	source := domain.LogSourceType{File: path}
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return nil
+		}
+		source.Line++
+		repository.IngestPush(ctx, p, source, scanner.Text())
+	}
+
+	return scanner.Err()
 }
@@ -2,24 +2,70 @@ package service
 
 import (
 	"fmt"
-	"path/filepath"
+	"strings"
 
+	"github.com/jmticonap/real-logs/domain"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
 )
 
-func GetKubernetesClient() (*kubernetes.Clientset, error) {
-	// Intenta config InCluster
-	config, err := rest.InClusterConfig()
+// GetKubernetesClient builds a client with the kubectl precedence: the
+// kubeconfig path if set, otherwise KUBECONFIG, otherwise ~/.kube/config,
+// and the in-cluster config when none of them exists. kubeContext selects
+// a context other than the current one. It also returns the namespace of
+// the selected context.
+func GetKubernetesClient(kubeconfig, kubeContext string) (*kubernetes.Clientset, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		rules.ExplicitPath = kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	config, err := clientConfig.ClientConfig()
 	if err != nil {
-		// Si falla, intenta con kubeconfig local
-		kubeconfig := filepath.Join(homedir.HomeDir(), ".kube", "config")
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			return nil, fmt.Errorf("error creando config Kubernetes: %w", err)
+		return nil, "", fmt.Errorf("error creando config Kubernetes: %w", err)
+	}
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, "", fmt.Errorf("error leyendo namespace del contexto: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return clientset, namespace, nil
+}
+
+// ParseNamespaces splits a comma separated list of namespaces.
+func ParseNamespaces(value string) []string {
+	namespaces := []string{}
+	for _, namespace := range strings.Split(value, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces = append(namespaces, namespace)
 		}
 	}
-	return kubernetes.NewForConfig(config)
+
+	return namespaces
+}
+
+// targetNamespaces returns the namespaces to collect from, without
+// repetitions. An empty namespace means every namespace.
+func targetNamespaces(cfg *domain.Config) []string {
+	namespaces := []string{}
+	seen := map[string]bool{}
+	for _, namespace := range append([]string{cfg.Namespace}, cfg.Namespaces...) {
+		if namespace == "" || seen[namespace] {
+			continue
+		}
+		seen[namespace] = true
+		namespaces = append(namespaces, namespace)
+	}
+	if len(namespaces) == 0 {
+		return []string{""}
+	}
+
+	return namespaces
 }
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/db"
+	"github.com/jmticonap/real-logs/infrastructure/repository"
+)
+
+// Lifecycle separates the context of the producers, the flows that read
+// or download logs, from the one of the SQLite writers. Cancelling the
+// producers stops the collection while the writers keep persisting what
+// is still queued until Shutdown drains them.
+type Lifecycle struct {
+	ctx           context.Context
+	cancel        context.CancelFunc
+	writerCtx     context.Context
+	cancelWriters context.CancelFunc
+	store         *db.Store
+	sink          repository.LogSink
+	once          sync.Once
+	summary       domain.IngestSummaryType
+}
+
+// NewLifecycle derives both contexts from parent. sink and store are
+// closed by Shutdown.
+func NewLifecycle(parent context.Context, store *db.Store, sink repository.LogSink) *Lifecycle {
+	ctx, cancel := context.WithCancel(parent)
+	writerCtx, cancelWriters := context.WithCancel(context.WithoutCancel(parent))
+
+	return &Lifecycle{
+		ctx:           ctx,
+		cancel:        cancel,
+		writerCtx:     writerCtx,
+		cancelWriters: cancelWriters,
+		store:         store,
+		sink:          sink,
+	}
+}
+
+// Context is cancelled by Stop; the flows must return once it is done.
+func (l *Lifecycle) Context() context.Context {
+	return l.ctx
+}
+
+// WriterContext is only cancelled by Shutdown, after the producers ended.
+func (l *Lifecycle) WriterContext() context.Context {
+	return l.writerCtx
+}
+
+// Stop asks the producers to finish, e.g. on SIGINT.
+func (l *Lifecycle) Stop() {
+	l.cancel()
+}
+
+// Shutdown persists every queued line and releases the database. It must
+// be called after the flows returned, so no line is pushed meanwhile:
+// the ingest pipeline is closed and waited, then the writers flush their
+// last batches and the database is closed. It returns the totals of the
+// run and can be called more than once.
+func (l *Lifecycle) Shutdown() domain.IngestSummaryType {
+	l.once.Do(func() {
+		l.cancel()
+		repository.StopIngestPipeline()
+		l.cancelWriters()
+		repository.WaitWriters()
+		if err := l.sink.Close(); err != nil {
+			log.Printf("Error cerrando el destino de los logs: %v", err)
+		}
+		if err := l.store.Close(); err != nil {
+			log.Printf("Error cerrando la base de datos: %v", err)
+		}
+		l.summary = repository.IngestSummary()
+	})
+
+	return l.summary
+}
+
+// LogIngestSummary prints the totals of a run.
+func LogIngestSummary(summary domain.IngestSummaryType) {
+	log.Printf(
+		"Resumen: leídas=%d parseadas=%d sin parsear=%d guardadas=%d fallidas=%d",
+		summary.Read,
+		summary.Parsed,
+		summary.Unparsed,
+		summary.Stored,
+		summary.Failed,
+	)
+}
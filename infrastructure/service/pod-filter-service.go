@@ -0,0 +1,96 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jmticonap/real-logs/domain"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// podMatcher checks the parts of domain.PodFilterType that the API
+// server cannot filter: owner, name regex and annotations.
+type podMatcher struct {
+	ownerKind   string
+	ownerName   string
+	nameRegex   *regexp.Regexp
+	annotations domain.StrObject
+}
+
+func newPodMatcher(filter domain.PodFilterType) (*podMatcher, error) {
+	if filter.FieldSelector != "" {
+		if _, err := fields.ParseSelector(filter.FieldSelector); err != nil {
+			return nil, fmt.Errorf("fieldSelector inválido: %w", err)
+		}
+	}
+
+	m := &podMatcher{annotations: filter.Annotations}
+	if filter.Owner != "" {
+		kind, name, found := strings.Cut(filter.Owner, "/")
+		if !found || kind == "" || name == "" {
+			return nil, fmt.Errorf("owner inválido %q, se espera <Kind>/<nombre>", filter.Owner)
+		}
+		m.ownerKind = kind
+		m.ownerName = name
+	}
+	if filter.NameRegex != "" {
+		re, err := regexp.Compile(filter.NameRegex)
+		if err != nil {
+			return nil, fmt.Errorf("nameRegex inválido: %w", err)
+		}
+		m.nameRegex = re
+	}
+
+	return m, nil
+}
+
+func (m *podMatcher) matches(pod *corev1.Pod) bool {
+	if m.nameRegex != nil && !m.nameRegex.MatchString(pod.Name) {
+		return false
+	}
+	for key, value := range m.annotations {
+		if annotation, ok := pod.Annotations[key]; !ok || (value != "" && annotation != value) {
+			return false
+		}
+	}
+	if m.ownerKind != "" && !m.ownedBy(pod) {
+		return false
+	}
+
+	return true
+}
+
+// ownedBy reports whether the pod belongs to the owner. Pods of a
+// Deployment are owned by its ReplicaSet, named after the Deployment and
+// the pod-template-hash label.
+func (m *podMatcher) ownedBy(pod *corev1.Pod) bool {
+	for _, owner := range pod.OwnerReferences {
+		if strings.EqualFold(owner.Kind, m.ownerKind) && owner.Name == m.ownerName {
+			return true
+		}
+		if strings.EqualFold(m.ownerKind, "Deployment") && owner.Kind == "ReplicaSet" &&
+			owner.Name == m.ownerName+"-"+pod.Labels["pod-template-hash"] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseAnnotations reads a comma separated list of key=value pairs. A
+// key without value only requires the annotation to exist.
+func ParseAnnotations(value string) domain.StrObject {
+	annotations := domain.StrObject{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, val, _ := strings.Cut(pair, "=")
+		annotations[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+
+	return annotations
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/repository"
+)
+
+var queryColumns = []string{
+	"timestamp",
+	"level",
+	"hostname",
+	"pod",
+	"container",
+	"trace_id",
+	"span_id",
+	"parent_id",
+	"msg",
+}
+
+// QueryProcess prints the general_logs rows matching filter to out in
+// the requested format (table, json lines or csv).
+func QueryProcess(
+	ctx context.Context,
+	db *sql.DB,
+	filter domain.LogFilter,
+	format string,
+	out io.Writer,
+) error {
+	switch format {
+	case domain.OutputTable, "":
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(queryColumns, "\t")))
+		err := repository.QueryGeneralLogs(ctx, db, filter, func(item domain.GeneralLogRecordType) error {
+			_, err := fmt.Fprintln(w, strings.Join(logRow(item, true), "\t"))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return w.Flush()
+
+	case domain.OutputJson:
+		encoder := json.NewEncoder(out)
+		return repository.QueryGeneralLogs(ctx, db, filter, func(item domain.GeneralLogRecordType) error {
+			return encoder.Encode(item)
+		})
+
+	case domain.OutputCsv:
+		w := csv.NewWriter(out)
+		if err := w.Write(queryColumns); err != nil {
+			return err
+		}
+		err := repository.QueryGeneralLogs(ctx, db, filter, func(item domain.GeneralLogRecordType) error {
+			return w.Write(logRow(item, false))
+		})
+		if err != nil {
+			return err
+		}
+		w.Flush()
+		return w.Error()
+
+	default:
+		return fmt.Errorf("formato de salida no soportado: %s", format)
+	}
+}
+
+// logRow returns the columns of item in queryColumns order. For the
+// table output the message is folded into a single line.
+func logRow(item domain.GeneralLogRecordType, singleLine bool) []string {
+	msg := item.Msg
+	if singleLine {
+		msg = strings.Join(strings.Fields(msg), " ")
+	}
+
+	return []string{
+		item.Timestamp,
+		item.Level,
+		item.Hostname,
+		item.Source.Pod,
+		item.Source.Container,
+		item.TraceId,
+		item.SpanId,
+		item.ParentId,
+		msg,
+	}
+}
@@ -3,136 +3,369 @@ package service
 import (
 	"bufio"
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/db"
+	"github.com/jmticonap/real-logs/infrastructure/parser"
 	"github.com/jmticonap/real-logs/infrastructure/repository"
+	"github.com/jmticonap/real-logs/utils"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 )
 
-func RealTimeProcess(ctx context.Context, cfg *domain.Config) {
-	clientset, err := GetKubernetesClient()
+// errStreamClosed is returned by streamLogs when the container stops
+// writing, usually because it finished or crashed.
+var errStreamClosed = errors.New("stream cerrado")
+
+// containerStream is the log download of one container instance. done
+// is closed when the download ends; lines is valid after that.
+type containerStream struct {
+	cancel  context.CancelFunc
+	done    chan struct{}
+	restart int32
+	lines   int
+}
+
+// realTimeCollector keeps one log stream per pod container and starts a
+// new one when the container restarts.
+type realTimeCollector struct {
+	ctx       context.Context
+	clientset kubernetes.Interface
+	cfg       *domain.Config
+	database  *sql.DB
+	parsers   *parser.Registry
+	matcher   *podMatcher
+	dir       string
+
+	// Descargas de logs por pod/container
+	mu      sync.Mutex
+	streams map[string]*containerStream
+	running sync.WaitGroup
+}
+
+// RealTimeProcess follows the logs of every pod selected by cfg until ctx
+// is cancelled, using clientset to reach the cluster and store for the
+// stream checkpoints. It returns after every download ended, so no more
+// lines are queued, or right away with an error when the collection of
+// cfg cannot start.
+func RealTimeProcess(
+	ctx context.Context,
+	store *db.Store,
+	clientset kubernetes.Interface,
+	cfg *domain.Config,
+	parsers *parser.Registry,
+) error {
+	matcher, err := newPodMatcher(cfg.Pods)
 	if err != nil {
-		log.Fatalf("Error creando cliente: %v", err)
+		return fmt.Errorf("error en la selección de pods: %w", err)
+	}
+
+	dir, err := getOutputDir(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("error creando directorio de logs: %w", err)
+	}
+	collector := &realTimeCollector{
+		ctx:       ctx,
+		clientset: clientset,
+		cfg:       cfg,
+		database:  store.DB(),
+		parsers:   parsers,
+		matcher:   matcher,
+		dir:       dir,
+		streams:   map[string]*containerStream{},
+	}
+
+	factories := []informers.SharedInformerFactory{}
+	for _, namespace := range targetNamespaces(cfg) {
+		factory, err := collector.watch(namespace, getLabelSelector(ctx, cfg), cfg.Pods.FieldSelector)
+		if err != nil {
+			return err
+		}
+		factories = append(factories, factory)
 	}
 
-	// Mapa para controlar descargas activas de logs: podName -> cancelFunc
-	activeLogs := make(map[string]context.CancelFunc)
-	var mu sync.Mutex
+	log.Println("Observando pods...")
+	for _, factory := range factories {
+		factory.Start(ctx.Done())
+	}
+
+	<-ctx.Done()
+	for _, factory := range factories {
+		factory.Shutdown()
+	}
+	collector.stopAll()
 
-	watcher, err := clientset.CoreV1().Pods(cfg.Namespace).Watch(ctx, metav1.ListOptions{
-		LabelSelector: getLabelSelector(ctx, cfg),
+	return nil
+}
+
+// watch creates the pod informer of one namespace. The informer lists
+// and watches again with exponential backoff when the API server closes
+// the watch, so the collection does not stop.
+func (c *realTimeCollector) watch(namespace, labelSelector, fieldSelector string) (informers.SharedInformerFactory, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		c.clientset,
+		0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = labelSelector
+			options.FieldSelector = fieldSelector
+		}),
+	)
+	informer := factory.Core().V1().Pods().Informer()
+	err := informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		log.Printf("Watch de pods en %q interrumpido, reconectando: %v", namespace, err)
 	})
 	if err != nil {
-		log.Fatalf("Error creando watcher: %v", err)
+		return nil, fmt.Errorf("error creando watcher de %q: %w", namespace, err)
+	}
+	_, err = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				c.syncPod(pod)
+			}
+		},
+		UpdateFunc: func(_, obj any) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				c.syncPod(pod)
+			}
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				c.removePod(pod)
+			}
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creando watcher de %q: %w", namespace, err)
 	}
-	defer watcher.Stop()
 
-	log.Println("Observando pods...")
+	return factory, nil
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			// Cancelar todos los logs activos
-			mu.Lock()
-			for pod, cancelFunc := range activeLogs {
-				log.Printf("Cancelando log stream de pod %s", pod)
-				cancelFunc()
+// syncPod starts the download of every container of a Running pod that
+// is not being downloaded. When a container restarted, the logs of the
+// terminated instance are read once with Previous before following the
+// new one, so the lines written just before a crash are not lost.
+func (c *realTimeCollector) syncPod(pod *corev1.Pod) {
+	if pod.Status.Phase != corev1.PodRunning || !c.matcher.matches(pod) {
+		return
+	}
+
+	p := c.parsers.ForLabels(pod.Labels)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, container := range selectContainers(pod, c.cfg.Containers) {
+		key := streamKey(pod.Namespace, pod.Name, container.Name)
+		restartCount := containerRestartCount(pod, container.Name)
+		current, exists := c.streams[key]
+
+		var previous *containerStream
+		switch {
+		case !exists:
+			log.Printf("Pod %s está Running, iniciando descarga de logs de %s", pod.Name, container.Name)
+		case !container.Init && restartCount > current.restart:
+			log.Printf("Contenedor %s/%s reiniciado (%d), recuperando logs previos", pod.Name, container.Name, restartCount)
+			// Lo que el stream anterior no llegó a leer se recupera con Previous
+			current.cancel()
+			previous = current
+		case !container.Init && isDone(current):
+			// El stream se cerró sin reinicio (p. ej. el API server lo cortó)
+			log.Printf("Reanudando descarga de logs de %s", key)
+		default:
+			continue
+		}
+
+		source := domain.LogSourceType{
+			Cluster:   c.cfg.Cluster,
+			Pod:       pod.Name,
+			Namespace: pod.Namespace,
+			Container: container.Name,
+			Node:      pod.Spec.NodeName,
+			Restart:   restartCount,
+		}
+		c.streams[key] = c.start(p, source, container.Init, previous)
+	}
+}
+
+// start launches the download of source in its own goroutine. When
+// previous is set it first waits for it to end and ingests the rest of
+// its logs. A stream that fails or is closed by the API server is opened
+// again with exponential backoff, resuming after the last line read,
+// until the stream is cancelled.
+func (c *realTimeCollector) start(
+	p parser.Parser,
+	source domain.LogSourceType,
+	init bool,
+	previous *containerStream,
+) *containerStream {
+	logCtx, logCancel := context.WithCancel(c.ctx)
+	stream := &containerStream{
+		cancel:  logCancel,
+		done:    make(chan struct{}),
+		restart: source.Restart,
+	}
+
+	c.running.Add(1)
+	go func() {
+		defer c.running.Done()
+		defer close(stream.done)
+
+		if previous != nil {
+			select {
+			case <-previous.done:
+			case <-logCtx.Done():
+				return
+			}
+			prevSource := source
+			prevSource.Restart = previous.restart
+			err := collectPreviousLogs(logCtx, c.clientset, p, c.dir, prevSource, previous.lines)
+			if err != nil {
+				log.Printf("Error obteniendo logs previos de %s/%s: %v", source.Pod, source.Container, err)
 			}
-			mu.Unlock()
-			return
-		case event, ok := <-watcher.ResultChan():
-			if !ok {
-				log.Println("Watcher cerrado, terminando.")
+		}
+
+		checkpoint := loadCheckpoint(logCtx, c.database, source)
+		tracker := repository.NewLineTracker(checkpoint, checkpointInterval, func(checkpoint domain.StreamCheckpointType) {
+			saveCheckpoint(c.database, checkpoint)
+		})
+		defer tracker.Close()
+
+		backoff := streamRetryMin
+		for {
+			resume := newStreamResume(checkpoint)
+			source.Line = checkpoint.Line
+			err := streamLogs(logCtx, c.clientset, p, c.dir, source, resume, tracker)
+			stream.lines = resume.checkpoint.Line
+			if logCtx.Err() != nil {
 				return
 			}
+			// Un init container termina antes de que el pod esté Running:
+			// sus logs ya se leyeron completos.
+			if init && errors.Is(err, errStreamClosed) {
+				return
+			}
+			if resume.checkpoint.Line > checkpoint.Line {
+				backoff = streamRetryMin
+			}
+			checkpoint = resume.checkpoint
+			log.Printf("Error en streamLogs pod %s: %v, reintentando en %s", source.Pod, err, backoff)
 
-			pod, ok := event.Object.(*corev1.Pod)
-			if !ok {
-				log.Println("Evento no es un Pod")
-				continue
+			select {
+			case <-logCtx.Done():
+				return
+			case <-time.After(backoff):
 			}
+			backoff = min(backoff*2, streamRetryMax)
+		}
+	}()
 
-			podName := pod.Name
-
-			mu.Lock()
-			cancelFunc, isActive := activeLogs[podName]
-			mu.Unlock()
-
-			switch event.Type {
-			case watch.Added, watch.Modified:
-				// Si el pod está Running y no estamos descargando logs para él, iniciar
-				if pod.Status.Phase == corev1.PodRunning && !isActive {
-					log.Printf("Pod %s está Running, iniciando descarga de logs", podName)
-					// Crear contexto para cancelar lectura de logs
-					logCtx, logCancel := context.WithCancel(ctx)
-
-					mu.Lock()
-					activeLogs[podName] = logCancel
-					mu.Unlock()
-
-					go func(pName string, c context.Context) {
-						err := streamLogs(
-							c,
-							clientset,
-							getDir(ctx, cfg),
-							cfg.Namespace,
-							pName,
-						)
-						if err != nil {
-							log.Printf("Error en streamLogs pod %s: %v", pName, err)
-						}
-						// Cuando termina la descarga, limpiar del mapa
-						mu.Lock()
-						delete(activeLogs, pName)
-						mu.Unlock()
-					}(podName, logCtx)
-				}
-			case watch.Deleted:
-				// Cuando un pod se elimina, cancelar la descarga de logs si estaba activa
-				if isActive {
-					log.Printf("Pod %s eliminado, cancelando descarga de logs", podName)
-					cancelFunc()
-					mu.Lock()
-					delete(activeLogs, podName)
-					mu.Unlock()
-				}
+	return stream
+}
+
+// removePod cancels the downloads of a deleted pod.
+func (c *realTimeCollector) removePod(pod *corev1.Pod) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, container := range selectContainers(pod, c.cfg.Containers) {
+		key := streamKey(pod.Namespace, pod.Name, container.Name)
+		if stream, ok := c.streams[key]; ok {
+			if !isDone(stream) {
+				log.Printf("Pod %s eliminado, cancelando descarga de logs de %s", pod.Name, container.Name)
 			}
+			stream.cancel()
+			delete(c.streams, key)
+		}
+	}
+}
+
+// stopAll cancels every active download and waits for them to end.
+func (c *realTimeCollector) stopAll() {
+	c.mu.Lock()
+	for key, stream := range c.streams {
+		if !isDone(stream) {
+			log.Printf("Cancelando log stream de %s", key)
+		}
+		stream.cancel()
+	}
+	c.mu.Unlock()
+
+	c.running.Wait()
+}
+
+func isDone(stream *containerStream) bool {
+	select {
+	case <-stream.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func containerRestartCount(pod *corev1.Pod, containerName string) int32 {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == containerName {
+			return status.RestartCount
 		}
 	}
+
+	return 0
 }
 
-// streamLogs streams the logs from a specified K8s pod in real-time, writing them to a local file
+// streamLogs streams the logs from a specified K8s pod container in real-time, writing them to a local file
 // and processing each log line asynchronously. It listens for context cancellation to gracefully stop streaming.
-// The function takes a context for cancellation, a Kubernetes clientset, the directory to store logs, the namespace,
-// and the pod name. It returns an error if any occurs during log streaming, file operations, or log processing.
+// The stream starts after the position of resume, so reconnecting does not duplicate nor miss lines, and every
+// line read is tracked until its row is stored. It returns an error if any occurs during log streaming or file
+// operations, and errStreamClosed when the container stops writing.
 //
 // Parameters:
 //   - ctx: Context for cancellation and timeout control.
-//   - clientset: Kubernetes clientset to interact with the cluster.
+//   - clientset: Kubernetes client to interact with the cluster.
+//   - p: Parser selected for the pod labels.
 //   - dir: Directory path where the log file will be stored.
-//   - namespace: Namespace of the target pod.
-//   - podName: Name of the pod to stream logs from.
+//   - source: Pod, namespace, container, node and restart of the target, stored with every line.
+//   - resume: Position of the stream, moved forward with every line read.
+//   - tracker: Tracker that saves the checkpoint once the lines are stored.
 //
 // Returns:
-//   - error: An error if streaming, file writing, or log processing fails; otherwise, nil.
+//   - error: An error if streaming or file writing fails; nil when ctx is cancelled.
 func streamLogs(
 	ctx context.Context,
-	clientset *kubernetes.Clientset,
-	dir, namespace, podName string,
+	clientset kubernetes.Interface,
+	p parser.Parser,
+	dir string,
+	source domain.LogSourceType,
+	resume *streamResume,
+	tracker *repository.LineTracker,
 ) error {
-	req := clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{
-		Follow: true,
-	})
+	podName := source.Pod
+	options := &corev1.PodLogOptions{
+		Container:  source.Container,
+		Follow:     true,
+		Timestamps: true,
+	}
+	if last := resume.checkpoint.LastTimestamp; !last.IsZero() {
+		log.Printf("Reanudando %s/%s desde %s", podName, source.Container, last.Format(time.RFC3339Nano))
+		options.SinceTime = &metav1.Time{Time: last}
+	}
+
+	req := clientset.CoreV1().Pods(source.Namespace).GetLogs(podName, options)
 
 	stream, err := req.Stream(ctx)
 	if err != nil {
@@ -141,54 +374,154 @@ func streamLogs(
 	defer stream.Close()
 
 	reader := bufio.NewReader(stream)
-	filename := filepath.Join(dir, podName+".log")
-	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	file, filename, err := openContainerLog(ctx, dir, podName, source.Container)
 	if err != nil {
 		return fmt.Errorf("error creando archivo log pod %s: %w", podName, err)
 	}
 	defer file.Close()
 
+	source.File = filename
 	for {
 		select {
 		case <-ctx.Done():
-			log.Printf("Cancelando streamLogs para pod %s", podName)
+			log.Printf("Cancelando streamLogs para pod %s/%s", podName, source.Container)
 			return nil
 		default:
 			lineBytes, err := reader.ReadString('\n')
-			if err != nil {
+			// Una última línea sin salto de línea se procesa antes del EOF
+			if err != nil && (err != io.EOF || lineBytes == "") {
 				if err == io.EOF {
-					return fmt.Errorf("stream cerrado para pod %s", podName)
+					return fmt.Errorf("%w para pod %s/%s", errStreamClosed, podName, source.Container)
 				}
 				return fmt.Errorf("error leyendo log pod %s: %w", podName, err)
 			}
-			line := strings.TrimSuffix(lineBytes, "\n")
+			lineTime, line, hasTime := splitKubeletTimestamp(strings.TrimSuffix(lineBytes, "\n"))
+			if !resume.accept(lineTime, hasTime) {
+				continue
+			}
+			source.Line++
+			resume.checkpoint.Line = source.Line
 
-			if _, wErr := file.WriteString(line + "\n"); wErr != nil {
+			if _, wErr := io.WriteString(file, line+"\n"); wErr != nil {
 				return fmt.Errorf("error escribiendo log pod %s: %w", podName, wErr)
 			}
 
-			go repository.SaveLog(ctx, line)
+			tracker.Track(resume.checkpoint)
+			repository.IngestPushTracked(ctx, p, source, line, tracker)
 		}
 	}
 }
 
+// loadCheckpoint returns the saved position of the stream of source, or
+// the start of the container when it is another instance.
+func loadCheckpoint(ctx context.Context, database *sql.DB, source domain.LogSourceType) domain.StreamCheckpointType {
+	checkpoint, found, err := repository.GetCheckpoint(ctx, database, source)
+	if err != nil {
+		log.Printf("Error leyendo checkpoint de %s/%s: %v", source.Pod, source.Container, err)
+	}
+	if found && checkpoint.Restart == source.Restart {
+		return checkpoint
+	}
+
+	// El contenedor es otra instancia: se lee desde el inicio
+	return domain.StreamCheckpointType{
+		Cluster:   source.Cluster,
+		Namespace: source.Namespace,
+		Pod:       source.Pod,
+		Container: source.Container,
+		Restart:   source.Restart,
+	}
+}
+
+// saveCheckpoint persists the position of a stream. It does not use the
+// stream context so the last position is saved after a cancellation.
+func saveCheckpoint(database *sql.DB, checkpoint domain.StreamCheckpointType) {
+	if checkpoint.LastTimestamp.IsZero() {
+		return
+	}
+	if err := repository.SaveCheckpoint(context.Background(), database, checkpoint); err != nil {
+		log.Printf("Error guardando checkpoint de %s/%s: %v", checkpoint.Pod, checkpoint.Container, err)
+	}
+}
+
+// collectPreviousLogs ingests the logs of the terminated instance of a
+// container, skipping the first skip lines that were already streamed.
+func collectPreviousLogs(
+	ctx context.Context,
+	clientset kubernetes.Interface,
+	p parser.Parser,
+	dir string,
+	source domain.LogSourceType,
+	skip int,
+) error {
+	req := clientset.CoreV1().Pods(source.Namespace).GetLogs(source.Pod, &corev1.PodLogOptions{
+		Container: source.Container,
+		Previous:  true,
+	})
+
+	stream, err := req.Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	file, filename, err := openContainerLog(ctx, dir, source.Pod, source.Container)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	source.File = filename
+
+	recovered := 0
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		source.Line++
+		if source.Line <= skip {
+			continue
+		}
+		line := scanner.Text()
+		if _, err := io.WriteString(file, line+"\n"); err != nil {
+			return err
+		}
+		repository.IngestPush(ctx, p, source, line)
+		recovered++
+	}
+	log.Printf("Recuperadas %d líneas previas de %s/%s (reinicio %d)", recovered, source.Pod, source.Container, source.Restart)
+
+	return scanner.Err()
+}
+
 // Take a path for the target directory, taking into account that
 // the first option it's witch come from flag.
 func getDir(ctx context.Context, cfg *domain.Config) string {
-	if ctx.Value(domain.CtxKeyType("dir")) != "" {
-		return ctx.Value(domain.CtxKeyType("dir")).(string)
-	} else {
-		return cfg.LogDirectory
+	if dir, _ := ctx.Value(domain.CtxKeyType("dir")).(string); dir != "" {
+		return dir
 	}
+
+	return cfg.LogDirectory
+}
+
+// getOutputDir returns the directory of the log files and creates it.
+// With several clusters the files of each one go in its own folder.
+func getOutputDir(ctx context.Context, cfg *domain.Config) (string, error) {
+	dir := filepath.Join(getDir(ctx, cfg), cfg.Cluster)
+	if err := utils.EnsureDir(dir); err != nil {
+		return "", err
+	}
+
+	return dir, nil
 }
 
+// getLabelSelector gives priority to the -srv flag, where "*" selects
+// every pod of the namespace.
 func getLabelSelector(ctx context.Context, cfg *domain.Config) string {
-	srvName := ctx.Value(domain.CtxKeyType("srvName"))
-	if srvName != "" {
-		return srvName.(string)
-	} else if srvName == "*" {
+	srvName, _ := ctx.Value(domain.CtxKeyType("srvName")).(string)
+	switch srvName {
+	case "*":
 		return ""
-	} else {
+	case "":
 		return cfg.LabelSelector
+	default:
+		return srvName
 	}
 }
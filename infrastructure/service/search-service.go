@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/repository"
+)
+
+var searchTableColumns = []string{
+	"timestamp",
+	"level",
+	"pod",
+	"container",
+	"trace_id",
+	"snippet",
+}
+
+// SearchProcess prints the general_logs rows whose message matches the
+// full-text query of options, the most relevant first, in the requested
+// format. The table shows the snippet of each message; json and csv also
+// carry the whole message and the rank.
+func SearchProcess(
+	ctx context.Context,
+	db *sql.DB,
+	filter domain.LogFilter,
+	options domain.SearchOptionsType,
+	format string,
+	out io.Writer,
+) error {
+	if strings.TrimSpace(options.Query) == "" {
+		return fmt.Errorf("la búsqueda necesita un texto (-match)")
+	}
+
+	switch format {
+	case domain.OutputTable, "":
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(searchTableColumns, "\t")))
+		err := repository.SearchGeneralLogs(ctx, db, filter, options, func(item domain.SearchResultType) error {
+			_, err := fmt.Fprintln(w, strings.Join([]string{
+				item.Timestamp,
+				item.Level,
+				item.Source.Pod,
+				item.Source.Container,
+				item.TraceId,
+				strings.Join(strings.Fields(item.Snippet), " "),
+			}, "\t"))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return w.Flush()
+
+	case domain.OutputJson:
+		encoder := json.NewEncoder(out)
+		return repository.SearchGeneralLogs(ctx, db, filter, options, func(item domain.SearchResultType) error {
+			return encoder.Encode(item)
+		})
+
+	case domain.OutputCsv:
+		w := csv.NewWriter(out)
+		if err := w.Write(slices.Concat(queryColumns, []string{"snippet", "rank"})); err != nil {
+			return err
+		}
+		err := repository.SearchGeneralLogs(ctx, db, filter, options, func(item domain.SearchResultType) error {
+			return w.Write(append(
+				logRow(item.GeneralLogRecordType, false),
+				item.Snippet,
+				strconv.FormatFloat(item.Rank, 'f', -1, 64),
+			))
+		})
+		if err != nil {
+			return err
+		}
+		w.Flush()
+		return w.Error()
+
+	default:
+		return fmt.Errorf("formato de salida no soportado: %s", format)
+	}
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/repository"
+	"github.com/jmticonap/real-logs/utils"
+)
+
+// TraceProcess loads every entry of traceId, rebuilds its span tree and
+// prints it to out as an indented timeline.
+func TraceProcess(ctx context.Context, db *sql.DB, traceId string, out io.Writer) error {
+	if traceId == "" {
+		return fmt.Errorf("debes proporcionar -trace")
+	}
+
+	entries := []domain.LogType{}
+	err := repository.QueryGeneralLogs(
+		ctx,
+		db,
+		domain.LogFilter{TraceId: traceId},
+		func(item domain.GeneralLogRecordType) error {
+			entries = append(entries, item.LogType)
+			return nil
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no se encontraron registros para el trace %s", traceId)
+	}
+
+	performance, err := repository.GetPerformanceByTrace(ctx, db, traceId)
+	if err != nil {
+		return err
+	}
+
+	RenderTrace(out, traceId, BuildTraceTree(entries, performance))
+	return nil
+}
+
+// BuildTraceTree groups entries by span id and links every span to its
+// parent. Spans whose parent is unknown (usually the one whose parentId
+// is the trace id) become roots. Performance rows are attached to the
+// span of the entry logged at the same instant.
+func BuildTraceTree(
+	entries []domain.LogType,
+	performance []domain.PerformanceRecordType,
+) []*domain.TraceSpanType {
+	spans := map[string]*domain.TraceSpanType{}
+	order := []*domain.TraceSpanType{}
+
+	for _, entry := range entries {
+		span, ok := spans[entry.SpanId]
+		if !ok {
+			span = &domain.TraceSpanType{SpanId: entry.SpanId}
+			spans[entry.SpanId] = span
+			order = append(order, span)
+		}
+		if span.ParentId == "" {
+			span.ParentId = entry.ParentId
+		}
+		span.Entries = append(span.Entries, entry)
+	}
+
+	for _, span := range order {
+		sort.SliceStable(span.Entries, func(i, j int) bool {
+			return entryTime(span.Entries[i]).Before(entryTime(span.Entries[j]))
+		})
+		for _, entry := range span.Entries {
+			t := entryTime(entry)
+			if t.IsZero() {
+				continue
+			}
+			if span.Start.IsZero() || t.Before(span.Start) {
+				span.Start = t
+			}
+			if t.After(span.End) {
+				span.End = t
+			}
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].Start.Before(order[j].Start)
+	})
+
+	roots := []*domain.TraceSpanType{}
+	for _, span := range order {
+		parent, ok := spans[span.ParentId]
+		if ok && parent != span {
+			parent.Children = append(parent.Children, span)
+		} else {
+			roots = append(roots, span)
+		}
+	}
+
+	// Spans that point at each other in a cycle are not reachable from
+	// any root; promote them so no entry is left out of the view.
+	visited := map[*domain.TraceSpanType]bool{}
+	var visit func(span *domain.TraceSpanType)
+	visit = func(span *domain.TraceSpanType) {
+		if visited[span] {
+			return
+		}
+		visited[span] = true
+		for _, child := range span.Children {
+			visit(child)
+		}
+	}
+	for _, root := range roots {
+		visit(root)
+	}
+	for _, span := range order {
+		if !visited[span] {
+			for _, other := range order {
+				other.Children = removeSpan(other.Children, span)
+			}
+			roots = append(roots, span)
+			visit(span)
+		}
+	}
+
+	for _, record := range performance {
+		span := spanForPerformance(order, record)
+		if span == nil && len(roots) > 0 {
+			span = roots[0]
+		}
+		if span != nil {
+			span.Performance = append(span.Performance, record)
+		}
+	}
+
+	return roots
+}
+
+// RenderTrace writes roots as an indented timeline. Offsets are relative
+// to the earliest entry of the trace.
+func RenderTrace(out io.Writer, traceId string, roots []*domain.TraceSpanType) {
+	var traceStart, traceEnd time.Time
+	spanCount, entryCount := 0, 0
+	var walk func(span *domain.TraceSpanType)
+	walk = func(span *domain.TraceSpanType) {
+		spanCount++
+		entryCount += len(span.Entries)
+		if !span.Start.IsZero() && (traceStart.IsZero() || span.Start.Before(traceStart)) {
+			traceStart = span.Start
+		}
+		if span.End.After(traceEnd) {
+			traceEnd = span.End
+		}
+		for _, child := range span.Children {
+			walk(child)
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+	}
+
+	fmt.Fprintf(
+		out,
+		"Trace %s | spans=%d entries=%d duración=%s\n",
+		traceId,
+		spanCount,
+		entryCount,
+		formatDuration(traceEnd.Sub(traceStart)),
+	)
+
+	var render func(span *domain.TraceSpanType, depth int)
+	render = func(span *domain.TraceSpanType, depth int) {
+		indent := strings.Repeat("  ", depth)
+		spanId := span.SpanId
+		if spanId == "" {
+			spanId = "(sin span)"
+		}
+		fmt.Fprintf(
+			out,
+			"%s└─ span %s +%s duración=%s\n",
+			indent,
+			spanId,
+			formatDuration(offset(traceStart, span.Start)),
+			formatDuration(span.End.Sub(span.Start)),
+		)
+		for _, entry := range span.Entries {
+			fmt.Fprintf(
+				out,
+				"%s   +%-10s %-5s %s\n",
+				indent,
+				formatDuration(offset(traceStart, entryTime(entry))),
+				strings.TrimSpace(entry.Level),
+				firstLine(entry.Msg),
+			)
+		}
+		for _, record := range span.Performance {
+			fmt.Fprintf(
+				out,
+				"%s   · %s %.3fms %s\n",
+				indent,
+				record.Method,
+				record.Exectime,
+				record.MemoryUsage,
+			)
+		}
+		for _, child := range span.Children {
+			render(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		render(root, 0)
+	}
+}
+
+func spanForPerformance(
+	spans []*domain.TraceSpanType,
+	record domain.PerformanceRecordType,
+) *domain.TraceSpanType {
+	recordTime, err := utils.ParseTimestamp(record.Timestamp)
+	if err != nil {
+		return nil
+	}
+	for _, span := range spans {
+		for _, entry := range span.Entries {
+			if entryTime(entry).Equal(recordTime) {
+				return span
+			}
+		}
+	}
+
+	return nil
+}
+
+func removeSpan(spans []*domain.TraceSpanType, target *domain.TraceSpanType) []*domain.TraceSpanType {
+	result := spans[:0]
+	for _, span := range spans {
+		if span != target {
+			result = append(result, span)
+		}
+	}
+
+	return result
+}
+
+func entryTime(entry domain.LogType) time.Time {
+	t, err := utils.ParseTimestamp(entry.Timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+func offset(start, t time.Time) time.Duration {
+	if start.IsZero() || t.IsZero() {
+		return 0
+	}
+
+	return t.Sub(start)
+}
+
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+
+	return d.Round(time.Millisecond).String()
+}
+
+// firstLine shortens msg to its first line and at most 160 characters,
+// cut by runes so an accented character is not split.
+func firstLine(msg string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(msg), "\n")
+	if runes := []rune(line); len(runes) > 160 {
+		return string(runes[:160]) + "…"
+	}
+
+	return line
+}
@@ -2,22 +2,29 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"runtime/pprof"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/jmticonap/real-logs/domain"
 	"github.com/jmticonap/real-logs/infrastructure/db"
+	"github.com/jmticonap/real-logs/infrastructure/parser"
 	"github.com/jmticonap/real-logs/infrastructure/repository"
 	"github.com/jmticonap/real-logs/infrastructure/service"
 	"github.com/jmticonap/real-logs/utils"
+	"k8s.io/client-go/kubernetes"
 )
 
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to `file`")
@@ -27,11 +34,47 @@ func main() {
 	// Flags
 	flow := flag.String("flow", domain.RealTime, "Define que flujo se utiliza")
 	dir := flag.String("dir", "", "Define el path del directorio objetivo")
-	srvName := flag.String("srv", "", "Define el nombre del servicio con el cual se filtran los pods")
-	startFlag := flag.String("start", "", "Hora de inicio en formato HH:MM (opcional, también puede ir en config)")
-	endFlag := flag.String("end", "", "Hora de fin en formato HH:MM (opcional, también puede ir en config)")
+	srvName := flag.String("srv", "", "Label selector con el cual se filtran los pods, * para todos los pods")
+	fieldSelectorFlag := flag.String("field-selector", "", "Field selector de los pods, p. ej. spec.nodeName=node-1")
+	ownerFlag := flag.String("owner", "", "Dueño de los pods: Deployment/<nombre> o StatefulSet/<nombre>")
+	nameRegexFlag := flag.String("name-regex", "", "Expresión regular que debe cumplir el nombre del pod")
+	annotationFlag := flag.String("annotation", "", "Anotaciones requeridas, clave=valor separadas por coma")
+	startFlag := flag.String("start", "", "Inicio en HH:MM, 2006-01-02T15:04 o RFC3339 (opcional, también puede ir en config)")
+	endFlag := flag.String("end", "", "Fin en HH:MM, 2006-01-02T15:04 o RFC3339 (opcional, también puede ir en config)")
+	sinceFlag := flag.Duration("since", 0, "Inicio relativo a ahora, p. ej. 45m (flujo btimes)")
+	lastFlag := flag.Duration("last", 0, "Rango que termina ahora, p. ej. 2h (flujo btimes)")
+	tzFlag := flag.String("tz", "", "Zona horaria de las fechas sin zona: America/Lima, -05:00 o UTC (por defecto config o local)")
 	batchSize := flag.Int("batchs", 50, "Largo del batch para las inserciones")
+	flushInterval := flag.Duration("flush", 2*time.Second, "Intervalo máximo entre inserciones, 0 solo por tamaño de batch")
+	maxBytes := flag.Int("max-bytes", 1<<20, "Bytes acumulados que fuerzan la inserción del batch, 0 sin límite")
+	ingestWorkers := flag.Int("ingest-workers", runtime.NumCPU(), "Workers que parsean las líneas descargadas")
+	ingestQueue := flag.Int("ingest-queue", 1000, "Líneas en cola por worker de ingesta antes de frenar la descarga")
 	logPerform := flag.Bool("logperform", false, "Define si se procesan los datos del log de performance")
+	noFile := flag.Bool("nofile", false, "No escribe archivos de log, solo guarda en la base de datos (flujos realtime y btimes)")
+	storeFlag := flag.String("store", "", "Dónde se guardan los logs: sqlite, postgres o duckdb (por defecto config o sqlite)")
+	resetDb := flag.Bool("reset-db", false, "Elimina las tablas existentes antes de migrar la base de datos")
+	levelFlag := flag.String("level", "", "Filtra por nivel de log (flujos query, search y export)")
+	traceFlag := flag.String("trace", "", "Filtra por trace_id (flujos query, search, trace y export)")
+	hostFlag := flag.String("host", "", "Filtra por hostname (flujos query, search y export)")
+	clusterFlag := flag.String("cluster", "", "Filtra por clúster (flujos query, search y export)")
+	podFlag := flag.String("pod", "", "Filtra por nombre de pod (flujos query, search y export)")
+	containerFlag := flag.String("container", "", "Filtra por nombre de contenedor (flujos query, search y export)")
+	fromFlag := flag.String("from", "", "Desde HH:MM, 2006-01-02T15:04 o RFC3339 (flujos query, search y export)")
+	toFlag := flag.String("to", "", "Hasta HH:MM, 2006-01-02T15:04 o RFC3339 (flujos query, search y export)")
+	msgFlag := flag.String("msg", "", "Filtra por texto contenido en el mensaje (flujos query, search y export)")
+	regexFlag := flag.String("regex", "", "Filtra el mensaje por expresión regular (flujos query, search y export)")
+	matchFlag := flag.String("match", "", "Texto a buscar en los mensajes con sintaxis FTS5: términos, \"frases\", prefijo*, AND, OR, NOT (flujo search)")
+	formatFlag := flag.String("format", domain.OutputTable, "Formato de salida: table, json o csv (flujos query y search)")
+	exportDirFlag := flag.String("export-dir", "export", "Directorio de los archivos exportados (flujo export)")
+	exportFormatFlag := flag.String("export-format", domain.OutputParquet, "Formato de exportación: parquet, ndjson o csv (flujo export)")
+	partitionFlag := flag.String("partition", "", "Un archivo por hour o por pod, vacío un archivo por tabla (flujo export)")
+	limitFlag := flag.Int("limit", 0, "Cantidad máxima de registros, 0 sin límite (flujos query y search)")
+	workersFlag := flag.Int("workers", 4, "Contenedores descargados en paralelo (flujo btimes)")
+	limitBytesFlag := flag.Int64("limit-bytes", 0, "Máximo de bytes descargados por contenedor, 0 sin límite (flujo btimes)")
+	tailLinesFlag := flag.Int64("tail-lines", 0, "Solo las últimas N líneas de cada contenedor, 0 todas (flujo btimes)")
+	kubeconfigFlag := flag.String("kubeconfig", "", "Ruta del kubeconfig (por defecto KUBECONFIG o ~/.kube/config)")
+	contextFlag := flag.String("context", "", "Contexto del kubeconfig a utilizar (por defecto el actual)")
+	namespaceFlag := flag.String("namespace", "", "Namespaces separados por coma (por defecto config o el del contexto)")
 	flag.Parse()
 
 	// pprof for CPU
@@ -47,118 +90,282 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Manejo de señales para cerrar la app con CTRL+C
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-		<-c
-		cancel()
-	}()
-
 	// Leer archivo de configuración
 	cfg, err := service.LoadConfig("config.json")
 	if err != nil {
 		log.Fatalf("Error loading config: %v", err)
 	}
+	if *kubeconfigFlag != "" {
+		cfg.Kubeconfig = *kubeconfigFlag
+	}
+	if *contextFlag != "" {
+		cfg.Context = *contextFlag
+	}
+	if *namespaceFlag != "" {
+		service.SetNamespaces(cfg, service.ParseNamespaces(*namespaceFlag))
+	}
+	if *tzFlag != "" {
+		cfg.Timezone = *tzFlag
+	}
+	location, err := utils.ParseLocation(cfg.Timezone)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *fieldSelectorFlag != "" {
+		cfg.Pods.FieldSelector = *fieldSelectorFlag
+	}
+	if *ownerFlag != "" {
+		cfg.Pods.Owner = *ownerFlag
+	}
+	if *nameRegexFlag != "" {
+		cfg.Pods.NameRegex = *nameRegexFlag
+	}
+	if *annotationFlag != "" {
+		cfg.Pods.Annotations = service.ParseAnnotations(*annotationFlag)
+	}
 
+	storeOptions := domain.StoreOptionsType{Dir: cfg.LogDirectory, Reset: *resetDb}
 	if dir != nil && *dir != "" {
-		db.OpenDb(domain.StrObject{"dir": *dir})
-	} else {
-		db.OpenDb(domain.StrObject{"dir": cfg.LogDirectory})
+		storeOptions.Dir = *dir
+	}
+	store, err := db.NewStore(storeOptions)
+	if err != nil {
+		log.Fatalf("Error abriendo la base de datos: %v", err)
+	}
+	log.Printf("DB Opened: %s", store.Path())
+	database := store.DB()
+
+	if *storeFlag != "" {
+		cfg.Store = *storeFlag
+	}
+	if err := service.CheckStore(*flow, cfg.Store); err != nil {
+		log.Fatal(err)
+	}
+	var sink repository.LogSink
+	switch cfg.Store {
+	case "", domain.StoreSqlite:
+		sink = repository.NewSQLiteSink(store)
+	case domain.StorePostgres:
+		sink, err = repository.NewPostgresSink(context.Background(), cfg.PostgresDsn)
+		if err != nil {
+			log.Fatalf("Error conectando a postgres: %v", err)
+		}
+		log.Println("Guardando logs en postgres")
+	case domain.StoreDuckdb:
+		path := cfg.DuckdbPath
+		if path == "" {
+			path = filepath.Join(filepath.Dir(store.Path()), "log.duckdb")
+		}
+		sink, err = repository.NewDuckDBSink(path)
+		if err != nil {
+			log.Fatalf("Error abriendo duckdb: %v", err)
+		}
+		log.Printf("Guardando logs en duckdb: %s", path)
+	default:
+		log.Fatalf("store desconocido: %s", cfg.Store)
+	}
+
+	lifecycle := service.NewLifecycle(context.Background(), store, sink)
+	defer lifecycle.Shutdown()
+	ctx := lifecycle.Context()
+
+	// Manejo de señales para cerrar la app con CTRL+C: la primera detiene
+	// la recolección y guarda lo pendiente, la segunda sale de inmediato
+	go func() {
+		c := make(chan os.Signal, 2)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		<-c
+		log.Println("Deteniendo, guardando logs pendientes (CTRL+C de nuevo para salir)...")
+		lifecycle.Stop()
+		<-c
+		log.Println("Salida forzada, los logs pendientes se pierden")
+		os.Exit(1)
+	}()
+
+	parsers, err := parser.NewRegistry(cfg.Parsers)
+	if err != nil {
+		log.Fatalf("Error en la configuración de parsers: %v", err)
 	}
-	log.Println("DB Opened")
 
 	errLogDir := utils.EnsureDir(cfg.LogDirectory)
 	if errLogDir != nil {
 		log.Fatalf("Error creating log dir: %v", errLogDir)
 	}
 
-	repository.StartGeneralLogWorker(ctx, *batchSize)
-	repository.StartWriterWorker(ctx, *batchSize)
+	writerOptions := domain.WriterOptionsType{
+		BatchSize:     *batchSize,
+		MaxBytes:      *maxBytes,
+		FlushInterval: *flushInterval,
+	}
+	writerCtx := lifecycle.WriterContext()
+	repository.StartGeneralLogWorker(writerCtx, sink, writerOptions)
+	repository.StartWriterWorker(writerCtx, sink, writerOptions)
+	repository.StartRawLineWorker(writerCtx, sink, writerOptions)
+	repository.StartIngestPipeline(writerCtx, domain.IngestOptionsType{
+		Workers:   *ingestWorkers,
+		QueueSize: *ingestQueue,
+	})
 
-	switch *flow {
-	case domain.RealTime:
-		fmt.Println("Flujo RealTime")
-		log.Println("Download logs in real time.")
-
-		srvCtx := context.WithValue(
-			ctx,
-			domain.CtxKeyType("srvName"),
-			*srvName,
-		)
-		dirCtx := context.WithValue(
-			srvCtx,
-			domain.CtxKeyType("dir"),
-			*dir,
-		)
-		logPerformCtx := context.WithValue(
-			dirCtx,
-			domain.CtxKeyType("logPerform"),
-			*logPerform,
-		)
-		service.RealTimeProcess(logPerformCtx, cfg)
-
-	case domain.BetweenTimes:
-		fmt.Println("Flujo BetweenTimes")
-		log.Println("Download logs between times.")
-		var startTimeStr, endTimeStr string
-
-		if *startFlag != "" {
-			startTimeStr = *startFlag
-			endTimeStr = *endFlag
-		} else if cfg.StartTime != "" {
-			startTimeStr = cfg.StartTime
-			endTimeStr = cfg.EndTime
-		} else {
-			log.Fatal("Debes proporcionar -start al menos y/o -end o definirlos en config.json")
-		}
+	// Opciones compartidas por los flujos que descargan o leen logs
+	srvCtx := context.WithValue(
+		ctx,
+		domain.CtxKeyType("srvName"),
+		*srvName,
+	)
+	dirCtx := context.WithValue(
+		srvCtx,
+		domain.CtxKeyType("dir"),
+		*dir,
+	)
+	logPerformCtx := context.WithValue(
+		dirCtx,
+		domain.CtxKeyType("logPerform"),
+		*logPerform,
+	)
+	noFileCtx := context.WithValue(
+		logPerformCtx,
+		domain.CtxKeyType("noFile"),
+		*noFile,
+	)
 
-		startTime, err := utils.ParseHour(startTimeStr)
-		if err != nil {
-			log.Fatalf("startTime inválido: %v", err)
-		}
+	// Los errores del flujo se informan después del drenado final, así
+	// lo ya leído se guarda igual
+	flowErr := func() error {
+		switch *flow {
+		case domain.RealTime:
+			fmt.Println("Flujo RealTime")
+			log.Println("Download logs in real time.")
+
+			return forEachTarget(cfg, func(target *domain.Config, clientset kubernetes.Interface) error {
+				return service.RealTimeProcess(noFileCtx, store, clientset, target, parsers)
+			})
+
+		case domain.BetweenTimes:
+			fmt.Println("Flujo BetweenTimes")
+			log.Println("Download logs between times.")
+			var startTimeStr, endTimeStr string
+
+			if *startFlag != "" || *sinceFlag > 0 || *lastFlag > 0 {
+				startTimeStr = *startFlag
+				endTimeStr = *endFlag
+			} else if cfg.StartTime != "" {
+				startTimeStr = cfg.StartTime
+				endTimeStr = cfg.EndTime
+			} else {
+				return errors.New("debes proporcionar -start, -since o -last y opcionalmente -end, o definirlos en config.json")
+			}
 
-		var endTime time.Time
-		if endTimeStr != "" {
-			endTime, err = utils.ParseHour(endTimeStr)
+			startTime, endTime, err := utils.ResolveTimeRange(
+				startTimeStr,
+				endTimeStr,
+				*sinceFlag,
+				*lastFlag,
+				location,
+				time.Now(),
+			)
 			if err != nil {
-				log.Fatalf("endTime inválido: %v", err)
+				return err
 			}
-		} else {
-			endTime = time.Now()
-		}
 
-		if endTime.Before(startTime) {
-			log.Fatal("endTime no puede ser anterior a startTime")
-		}
+			log.Printf(
+				"Descargando logs entre %s y %s...\n",
+				startTime.Format(time.RFC3339),
+				endTime.Format(time.RFC3339),
+			)
+			downloadOptions := domain.DownloadOptionsType{
+				Workers:    *workersFlag,
+				LimitBytes: *limitBytesFlag,
+				TailLines:  *tailLinesFlag,
+			}
+			return forEachTarget(cfg, func(target *domain.Config, clientset kubernetes.Interface) error {
+				return service.BetweenTimesProcess(noFileCtx, clientset, target, parsers, startTime, endTime, downloadOptions)
+			})
 
-		log.Printf(
-			"Descargando logs entre %s y %s...\n",
-			startTime.Format("15:04"),
-			endTime.Format("15:04"),
-		)
-		service.BetweenTimesProcess(ctx, cfg, startTime, endTime)
-
-	case domain.FromDir:
-		var targetDir string
-		if dir != nil && *dir != "" {
-			fmt.Printf("flag| dir=%s\n", *dir)
-			targetDir = *dir
-		} else if cfg.LogDirectory != "" {
-			fmt.Printf("Config: %s", cfg.LogDirectory)
-			targetDir = cfg.LogDirectory
-		} else {
-			log.Fatalln("No hay un directorio destino configurado.")
+		case domain.FromDir:
+			var targetDir string
+			if dir != nil && *dir != "" {
+				fmt.Printf("flag| dir=%s\n", *dir)
+				targetDir = *dir
+			} else if cfg.LogDirectory != "" {
+				fmt.Printf("Config: %s", cfg.LogDirectory)
+				targetDir = cfg.LogDirectory
+			} else {
+				return errors.New("no hay un directorio destino configurado")
+			}
+			return service.FromDir(logPerformCtx, parsers.Default(), targetDir)
+
+		case domain.Query, domain.Search, domain.Export:
+			filter := domain.LogFilter{
+				Level:     *levelFlag,
+				TraceId:   *traceFlag,
+				Hostname:  *hostFlag,
+				Cluster:   *clusterFlag,
+				Pod:       *podFlag,
+				Container: *containerFlag,
+				Msg:       *msgFlag,
+				Limit:     *limitFlag,
+			}
+			if *fromFlag != "" {
+				filter.From, err = utils.ParseTimeIn(*fromFlag, location, time.Now())
+				if err != nil {
+					return fmt.Errorf("from inválido: %w", err)
+				}
+			}
+			if *toFlag != "" {
+				filter.To, err = utils.ParseTimeIn(*toFlag, location, time.Now())
+				if err != nil {
+					return fmt.Errorf("to inválido: %w", err)
+				}
+			}
+			if *regexFlag != "" {
+				filter.MsgRegex, err = regexp.Compile(*regexFlag)
+				if err != nil {
+					return fmt.Errorf("regex inválido: %w", err)
+				}
+			}
+			if *flow == domain.Export {
+				err = service.ExportProcess(ctx, database, filter, domain.ExportOptionsType{
+					Dir:       *exportDirFlag,
+					Format:    *exportFormatFlag,
+					Partition: *partitionFlag,
+					Location:  location,
+				})
+				if err != nil {
+					return fmt.Errorf("error en export: %w", err)
+				}
+				return nil
+			}
+			if *flow == domain.Search {
+				if !store.FullTextSearch() {
+					return repository.ErrNoFullTextSearch
+				}
+				options := domain.SearchOptionsType{Query: *matchFlag, HighlightStart: "**", HighlightEnd: "**"}
+				if isTerminal(os.Stdout) && (*formatFlag == domain.OutputTable || *formatFlag == "") {
+					options.HighlightStart, options.HighlightEnd = "\x1b[1;31m", "\x1b[0m"
+				}
+				if err := service.SearchProcess(ctx, database, filter, options, *formatFlag, os.Stdout); err != nil {
+					return fmt.Errorf("error en search: %w", err)
+				}
+				return nil
+			}
+			if err := service.QueryProcess(ctx, database, filter, *formatFlag, os.Stdout); err != nil {
+				return fmt.Errorf("error en query: %w", err)
+			}
+
+		case domain.Trace:
+			if err := service.TraceProcess(ctx, database, *traceFlag, os.Stdout); err != nil {
+				return fmt.Errorf("error en trace: %w", err)
+			}
 		}
-		logPerformCtx := context.WithValue(
-			ctx,
-			domain.CtxKeyType("logPerform"),
-			*logPerform,
-		)
-		service.FromDir(logPerformCtx, targetDir)
+
+		return nil
+	}()
+
+	// Drenado final: pipeline, writers y base de datos
+	summary := lifecycle.Shutdown()
+	switch *flow {
+	case domain.RealTime, domain.BetweenTimes, domain.FromDir:
+		service.LogIngestSummary(summary)
 	}
 
 	// pprof for Memory
@@ -174,4 +381,77 @@ func main() {
 			log.Fatal("could not write memory profile: ", err)
 		}
 	}
+
+	if flowErr != nil {
+		pprof.StopCPUProfile()
+		log.Fatal(flowErr)
+	}
+}
+
+// isTerminal reports whether f is a terminal, where the matched terms of
+// a search are highlighted with colors instead of ** marks.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// forEachTarget runs process concurrently for every cluster of cfg and
+// waits for all of them. A cluster that cannot be reached or whose
+// process fails is logged without stopping the others; the returned error
+// only tells how many failed.
+func forEachTarget(cfg *domain.Config, process func(*domain.Config, kubernetes.Interface) error) error {
+	targets := service.SplitTargets(cfg)
+	var failed atomic.Int32
+	report := func(target *domain.Config, err error) {
+		failed.Add(1)
+		if target.Cluster != "" {
+			log.Printf("Error en el clúster %s: %v", target.Cluster, err)
+		} else {
+			log.Printf("Error: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		clientset, err := kubernetesClient(target)
+		if err != nil {
+			report(target, err)
+			continue
+		}
+		if target.Cluster != "" {
+			log.Printf("Recolectando del clúster %s (contexto %q)", target.Cluster, target.Context)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := process(target, clientset); err != nil {
+				report(target, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := failed.Load(); n > 0 {
+		return fmt.Errorf("%d de %d clústeres fallaron", n, len(targets))
+	}
+
+	return nil
+}
+
+// kubernetesClient connects to the cluster selected by cfg. Without a
+// namespace in the flags or the config, the one of the context is used.
+func kubernetesClient(cfg *domain.Config) (kubernetes.Interface, error) {
+	clientset, namespace, err := service.GetKubernetesClient(cfg.Kubeconfig, cfg.Context)
+	if err != nil {
+		return nil, fmt.Errorf("error creando cliente: %w", err)
+	}
+	if cfg.Namespace == "" && len(cfg.Namespaces) == 0 {
+		cfg.Namespace = namespace
+	}
+
+	return clientset, nil
 }
@@ -2,6 +2,7 @@ package db_test
 
 import (
 	"context"
+	"database/sql"
 	"os"
 	"path/filepath"
 	"testing"
@@ -9,118 +10,178 @@ import (
 	"github.com/jmticonap/real-logs/domain"
 	"github.com/jmticonap/real-logs/infrastructure/db"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestOpenDb_DefaultPath(t *testing.T) {
+func TestNewStore_DefaultPath(t *testing.T) {
 	// Arrange
-	params := domain.StrObject{}
-	defaultDbPath := "./log.db"
-
-	// Cleanup any existing default database file
-	os.Remove(defaultDbPath)
+	t.Chdir(t.TempDir())
 
 	// Act
-	database := db.OpenDb(params)
+	store, err := db.NewStore(domain.StoreOptionsType{})
+	require.NoError(t, err)
+	defer store.Close()
 
 	// Assert
-	assert.NotNil(t, database, "Database should not be nil")
-	assert.NoError(t, database.Ping(), "Should be able to ping the database")
+	assert.NoError(t, store.DB().Ping(), "Should be able to ping the database")
+	assert.Equal(t, "log.db", store.Path())
 
 	// Check if the file was created
-	_, err := os.Stat(defaultDbPath)
+	_, err = os.Stat("log.db")
 	assert.NoError(t, err, "Default database file should be created")
-
-	// Cleanup
-	database.Close()
-	os.Remove(defaultDbPath)
 }
 
-func TestOpenDb_CustomPath(t *testing.T) {
+func TestNewStore_CustomPath(t *testing.T) {
 	// Arrange
-	testDir := "./test_db_dir"
+	testDir := filepath.Join(t.TempDir(), "test_db_dir")
 	customDbPath := filepath.Join(testDir, "log.db")
-	params := domain.StrObject{"dir": testDir}
-
-	// Create test directory if it doesn't exist
-	os.MkdirAll(testDir, 0777)
-	defer os.RemoveAll(testDir) // Cleanup after test
 
 	// Act
-	database := db.OpenDb(params)
+	store, err := db.NewStore(domain.StoreOptionsType{Dir: testDir})
+	require.NoError(t, err)
+	defer store.Close()
 
 	// Assert
-	assert.NotNil(t, database, "Database should not be nil")
-	assert.NoError(t, database.Ping(), "Should be able to ping the database")
+	assert.NoError(t, store.DB().Ping(), "Should be able to ping the database")
+	assert.Equal(t, customDbPath, store.Path())
 
 	// Check if the file was created in the custom path
-	_, err := os.Stat(customDbPath)
+	_, err = os.Stat(customDbPath)
 	assert.NoError(t, err, "Custom database file should be created")
-
-	// Cleanup
-	database.Close()
 }
 
-func TestOpenDb_Singleton(t *testing.T) {
+func TestNewStore_Independent(t *testing.T) {
 	// Arrange
-	params := domain.StrObject{}
-	defaultDbPath := "./log.db"
-	os.Remove(defaultDbPath) // Ensure no existing file
+	dir := t.TempDir()
 
 	// Act
-	db1 := db.OpenDb(params)
-	db2 := db.OpenDb(params)
+	store1, err := db.NewStore(domain.StoreOptionsType{Dir: dir})
+	require.NoError(t, err)
+	store2, err := db.NewStore(domain.StoreOptionsType{Dir: dir})
+	require.NoError(t, err)
+	defer store2.Close()
+	require.NoError(t, store1.Close())
 
 	// Assert
-	assert.NotNil(t, db1, "First database instance should not be nil")
-	assert.NotNil(t, db2, "Second database instance should not be nil")
-	assert.Equal(t, db1, db2, "Should return the same database instance (singleton)")
-
-	// Cleanup
-	db1.Close()
-	os.Remove(defaultDbPath)
+	assert.Error(t, store1.DB().Ping(), "Closed store should not be usable")
+	assert.NoError(t, store2.DB().Ping(), "Closing a store should not close the others")
 }
 
-func TestOpenDb_TablesCreated(t *testing.T) {
+func TestNewStore_TablesCreated(t *testing.T) {
 	// Arrange
-	params := domain.StrObject{"dir": "./tables"}
-	defaultDbPath := "./tables/log.db"
-	os.Remove(defaultDbPath)
+	options := domain.StoreOptionsType{Dir: t.TempDir()}
 
 	// Act
-	database := db.OpenDb(params)
-	defer database.Close()
-	defer os.Remove(defaultDbPath)
-
-	// Assert
-	assert.NotNil(t, database, "Database should not be nil")
+	store, err := db.NewStore(options)
+	require.NoError(t, err)
+	defer store.Close()
+	database := store.DB()
 
 	// Verify if performance_logs table exists
-	_, err := database.ExecContext(context.Background(), "SELECT * FROM performance_logs LIMIT 1")
+	_, err = database.ExecContext(context.Background(), "SELECT * FROM performance_logs LIMIT 1")
 	assert.NoError(t, err, "performance_logs table should exist")
 
 	// Verify if general_logs table exists
 	_, err = database.ExecContext(context.Background(), "SELECT * FROM general_logs LIMIT 1")
 	assert.NoError(t, err, "general_logs table should exist")
+
+	// Verify if raw_lines table exists
+	_, err = database.ExecContext(context.Background(), "SELECT * FROM raw_lines LIMIT 1")
+	assert.NoError(t, err, "raw_lines table should exist")
 }
 
-func TestOpenDb_ExistingDb(t *testing.T) {
+func TestNewStore_ExistingDb(t *testing.T) {
 	// Arrange
-	defaultDbPath := "./exist/log.db"
-	params := domain.StrObject{"dir": "exist"}
+	options := domain.StoreOptionsType{Dir: t.TempDir()}
 
 	// create a db
-	db.OpenDb(params)
-	defer os.Remove(defaultDbPath)
+	first, err := db.NewStore(options)
+	require.NoError(t, err)
+	_, err = first.DB().Exec("INSERT INTO general_logs (level, msg) VALUES ('INFO', 'kept')")
+	require.NoError(t, err)
+	require.NoError(t, first.Close())
 
 	// Act
-	database := db.OpenDb(params)
-	defer database.Close()
+	store, err := db.NewStore(options)
+	require.NoError(t, err)
+	defer store.Close()
 
 	// Assert
-	assert.NotNil(t, database, "Database should not be nil")
-	assert.NoError(t, database.Ping(), "Should be able to ping the existing database")
+	var count int
+	require.NoError(t, store.DB().QueryRow("SELECT COUNT(*) FROM general_logs").Scan(&count))
+	assert.Equal(t, 1, count, "Existing rows should be kept")
+}
+
+func TestNewStore_Reset(t *testing.T) {
+	// Arrange
+	options := domain.StoreOptionsType{Dir: t.TempDir()}
+	first, err := db.NewStore(options)
+	require.NoError(t, err)
+	_, err = first.DB().Exec("INSERT INTO general_logs (level, msg) VALUES ('INFO', 'dropped')")
+	require.NoError(t, err)
+	require.NoError(t, first.Close())
 
-	// Verify tables are (re)created - attempt to query
-	_, err := database.ExecContext(context.Background(), "SELECT * FROM performance_logs LIMIT 1")
-	assert.NoError(t, err, "performance_logs table should exist in existing db")
+	// Act
+	options.Reset = true
+	store, err := db.NewStore(options)
+	require.NoError(t, err)
+	defer store.Close()
+
+	// Assert
+	var count int
+	require.NoError(t, store.DB().QueryRow("SELECT COUNT(*) FROM general_logs").Scan(&count))
+	assert.Zero(t, count, "Reset should drop the existing rows")
+}
+
+func TestNewStore_Pragmas(t *testing.T) {
+	// Arrange
+	store, err := db.NewStore(domain.StoreOptionsType{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer store.Close()
+
+	// Act
+	var journalMode string
+	var synchronous int
+	require.NoError(t, store.DB().QueryRow("PRAGMA journal_mode").Scan(&journalMode))
+	require.NoError(t, store.DB().QueryRow("PRAGMA synchronous").Scan(&synchronous))
+
+	// Assert
+	assert.Equal(t, "wal", journalMode)
+	assert.Equal(t, 1, synchronous, "synchronous should be NORMAL")
+	assert.GreaterOrEqual(t, store.VariableLimit(), 999)
+}
+
+func TestNewStore_SearchIndex(t *testing.T) {
+	// Arrange: rows inserted before the index exists
+	dir := t.TempDir()
+	conn, err := sql.Open("sqlite3", filepath.Join(dir, "log.db"))
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate(conn))
+	_, err = conn.Exec("INSERT INTO general_logs (level, msg) VALUES ('ERROR', 'timeout calling payments')")
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	// Act
+	store, err := db.NewStore(domain.StoreOptionsType{Dir: dir})
+	require.NoError(t, err)
+	defer store.Close()
+	if !store.FullTextSearch() {
+		t.Skip("SQLite sin FTS5, ejecutar con -tags sqlite_fts5")
+	}
+	_, err = store.DB().Exec("INSERT INTO general_logs (level, msg) VALUES ('INFO', 'payments approved')")
+	require.NoError(t, err)
+	_, err = store.DB().Exec("DELETE FROM general_logs WHERE msg LIKE 'timeout%'")
+	require.NoError(t, err)
+
+	// Assert
+	matches := func(query string) int {
+		var count int
+		require.NoError(t, store.DB().QueryRow(
+			"SELECT COUNT(*) FROM general_logs_fts WHERE general_logs_fts MATCH ?",
+			query,
+		).Scan(&count))
+		return count
+	}
+	assert.Equal(t, 1, matches("payments"), "Existing and new rows should be indexed")
+	assert.Equal(t, 0, matches("timeout"), "Deleted rows should leave the index")
 }
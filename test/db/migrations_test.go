@@ -0,0 +1,140 @@
+package db_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmticonap/real-logs/infrastructure/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTempDb(t *testing.T) *sql.DB {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "log.db"))
+	require.NoError(t, err, "No se pudo abrir la base de datos temporal")
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestMigrate(t *testing.T) {
+	t.Run("Should migrate an empty database to the latest version", func(t *testing.T) {
+		conn := openTempDb(t)
+
+		require.NoError(t, db.Migrate(conn))
+
+		version, err := db.SchemaVersion(conn)
+		assert.NoError(t, err)
+		assert.Equal(t, db.LatestVersion(), version)
+	})
+
+	t.Run("Should preserve existing rows when migrating again", func(t *testing.T) {
+		conn := openTempDb(t)
+		require.NoError(t, db.Migrate(conn))
+
+		_, err := conn.Exec("INSERT INTO general_logs (level, msg) VALUES ('INFO', 'keep me')")
+		require.NoError(t, err)
+
+		require.NoError(t, db.Migrate(conn))
+
+		var count int
+		require.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM general_logs").Scan(&count))
+		assert.Equal(t, 1, count, "Los registros existentes no deberían eliminarse")
+	})
+
+	t.Run("Should upgrade a database created before schema_version existed", func(t *testing.T) {
+		conn := openTempDb(t)
+		_, err := conn.Exec(`
+			CREATE TABLE general_logs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				level CHARACTER(15),
+				timestamp DATETIME,
+				pid NUMERIC,
+				hostname VARCHAR(255),
+				trace_id VARCHAR(40),
+				span_id VARCHAR(40),
+				parent_id VARCHAR(40),
+				msg TEXT
+			);
+			INSERT INTO general_logs (level, msg) VALUES ('INFO', 'legacy');
+		`)
+		require.NoError(t, err)
+
+		require.NoError(t, db.Migrate(conn))
+
+		var msg string
+		require.NoError(t, conn.QueryRow("SELECT msg FROM general_logs").Scan(&msg))
+		assert.Equal(t, "legacy", msg)
+	})
+
+	t.Run("Should drop all data on ResetSchema", func(t *testing.T) {
+		conn := openTempDb(t)
+		require.NoError(t, db.Migrate(conn))
+		_, err := conn.Exec("INSERT INTO general_logs (level, msg) VALUES ('INFO', 'drop me')")
+		require.NoError(t, err)
+
+		require.NoError(t, db.ResetSchema(conn))
+		require.NoError(t, db.Migrate(conn))
+
+		var count int
+		require.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM general_logs").Scan(&count))
+		assert.Equal(t, 0, count)
+	})
+}
+
+func TestMigrate_Indexes(t *testing.T) {
+	conn := openTempDb(t)
+	require.NoError(t, db.Migrate(conn))
+
+	tests := []struct {
+		name  string
+		query string
+		index string
+	}{
+		{
+			name:  "PorTraceId",
+			query: "SELECT * FROM general_logs WHERE trace_id = 'trace-1'",
+			index: "general_logs_trace_id",
+		},
+		{
+			name:  "PorRangoDeTiempo",
+			query: "SELECT * FROM general_logs WHERE julianday(timestamp) >= julianday('2025-05-19T12:00:00-05:00')",
+			index: "general_logs_timestamp",
+		},
+		{
+			name:  "PorNivel",
+			query: "SELECT * FROM general_logs WHERE UPPER(TRIM(level)) = UPPER('error')",
+			index: "general_logs_level",
+		},
+		{
+			name:  "PorHostname",
+			query: "SELECT * FROM general_logs WHERE hostname = 'pod-a'",
+			index: "general_logs_hostname",
+		},
+		{
+			name:  "PerformancePorTraceId",
+			query: "SELECT * FROM performance_logs WHERE trace_id = 'trace-1'",
+			index: "performance_logs_trace_id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := conn.Query("EXPLAIN QUERY PLAN " + tt.query)
+			require.NoError(t, err)
+			defer rows.Close()
+
+			plan := ""
+			for rows.Next() {
+				var id, parent, notUsed int
+				var detail string
+				require.NoError(t, rows.Scan(&id, &parent, &notUsed, &detail))
+				plan += detail + "\n"
+			}
+			require.NoError(t, rows.Err())
+			assert.Contains(t, plan, "INDEX "+tt.index, "La consulta debería usar el índice")
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package parser_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/db"
+	"github.com/jmticonap/real-logs/infrastructure/parser"
+	"github.com/jmticonap/real-logs/infrastructure/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     domain.ParserConfig
+		line    string
+		wantLog domain.LogType
+		wantErr bool
+	}{
+		{
+			name: "JsonSinMapeo",
+			cfg:  domain.ParserConfig{},
+			line: `{"level":"INFO","timestamp":"2025-05-15T17:22:59.820-05:00","traceId":"t1","msg":"ok"}`,
+			wantLog: domain.LogType{
+				Level:     "INFO",
+				Timestamp: "2025-05-15T17:22:59.820-05:00",
+				TraceId:   "t1",
+				Msg:       "ok",
+			},
+		},
+		{
+			name: "JsonConMapeoAnidado",
+			cfg: domain.ParserConfig{
+				Type:   domain.LogTypeJson,
+				Fields: domain.StrObject{"level": "severity", "msg": "message", "traceId": "trace.id"},
+			},
+			line: `{"severity":30,"message":"ok","trace":{"id":"t1"},"timestamp":"2025-05-15T17:22:59.820-05:00"}`,
+			wantLog: domain.LogType{
+				Level:     "30",
+				Timestamp: "2025-05-15T17:22:59.820-05:00",
+				TraceId:   "t1",
+				Msg:       "ok",
+			},
+		},
+		{
+			name:    "JsonInvalido",
+			cfg:     domain.ParserConfig{},
+			line:    "panic: runtime error",
+			wantErr: true,
+		},
+		{
+			name: "Logfmt",
+			cfg:  domain.ParserConfig{Type: domain.LogTypeLogfmt},
+			line: `level=warn ts=2025-05-15T17:22:59Z msg="slow \"query\"" trace_id=t1 host=pod-a`,
+			wantLog: domain.LogType{
+				Level:     "warn",
+				Timestamp: "2025-05-15T17:22:59.000+00:00",
+				Hostname:  "pod-a",
+				TraceId:   "t1",
+				Msg:       `slow "query"`,
+			},
+		},
+		{
+			name:    "LogfmtTextoPlano",
+			cfg:     domain.ParserConfig{Type: domain.LogTypeLogfmt},
+			line:    "Server started on port 8080",
+			wantErr: true,
+		},
+		{
+			name: "Combined",
+			cfg:  domain.ParserConfig{Type: domain.LogTypeCombined},
+			line: `10.0.0.1 - - [15/May/2025:17:22:59 -0500] "GET /charges HTTP/1.1" 502 512 "-" "curl/8.0"`,
+			wantLog: domain.LogType{
+				Level:     "ERROR",
+				Timestamp: "2025-05-15T17:22:59.000-05:00",
+				Msg:       "10.0.0.1 GET /charges HTTP/1.1 502 512",
+			},
+		},
+		{
+			name: "RegexConGruposMapeados",
+			cfg: domain.ParserConfig{
+				Type:    domain.LogTypeRegex,
+				Pattern: `^(?P<ts>\S+) \[(?P<level>\w+)\] (?P<msg>.*)$`,
+				Fields:  domain.StrObject{"timestamp": "ts"},
+			},
+			line: "2025-05-15T17:22:59Z [DEBUG] cache miss",
+			wantLog: domain.LogType{
+				Level:     "DEBUG",
+				Timestamp: "2025-05-15T17:22:59.000+00:00",
+				Msg:       "cache miss",
+			},
+		},
+		{
+			name: "RegexSinCoincidencia",
+			cfg: domain.ParserConfig{
+				Type:    domain.LogTypeRegex,
+				Pattern: `^(?P<level>\w+): (?P<msg>.*)$`,
+			},
+			line:    "   at Object.<anonymous>",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parser.New(tt.cfg)
+			require.NoError(t, err, "New() no debería retornar error")
+
+			gotLog, err := p.Parse(tt.line)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantLog, gotLog)
+			}
+		})
+	}
+}
+
+func TestKlogParser(t *testing.T) {
+	p, err := parser.New(domain.ParserConfig{Type: domain.LogTypeKlog})
+	require.NoError(t, err)
+
+	t.Run("Should parse klog lines", func(t *testing.T) {
+		gotLog, err := p.Parse("E0515 17:22:59.820123   12345 server.go:123] connection refused")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "ERROR", gotLog.Level)
+		assert.Equal(t, "connection refused", gotLog.Msg)
+		assert.Contains(t, gotLog.Timestamp, "-05-15T17:22:59.820")
+	})
+
+	t.Run("Should parse Go standard log lines", func(t *testing.T) {
+		gotLog, err := p.Parse("2025/05/15 17:22:59 listening on :8080")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "listening on :8080", gotLog.Msg)
+		assert.Contains(t, gotLog.Timestamp, "2025-05-15T17:22:59.000")
+	})
+}
+
+func TestNewParserErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  domain.ParserConfig
+	}{
+		{name: "TipoDesconocido", cfg: domain.ParserConfig{Type: "xml"}},
+		{name: "RegexSinPattern", cfg: domain.ParserConfig{Type: domain.LogTypeRegex}},
+		{name: "RegexSinGrupos", cfg: domain.ParserConfig{Type: domain.LogTypeRegex, Pattern: `^(\w+)$`}},
+		{name: "CampoDesconocido", cfg: domain.ParserConfig{Fields: domain.StrObject{"pid": "pid"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parser.New(tt.cfg)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry, err := parser.NewRegistry([]domain.ParserConfig{
+		{Selector: "app=nginx", Type: domain.LogTypeCombined},
+		{Selector: "app in (api, worker),tier=backend", Type: domain.LogTypeLogfmt},
+	})
+	require.NoError(t, err)
+
+	t.Run("Should pick the parser by pod labels", func(t *testing.T) {
+		_, err := registry.ForLabels(map[string]string{"app": "worker", "tier": "backend"}).
+			Parse("level=info msg=ok")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Should fall back to json", func(t *testing.T) {
+		_, err := registry.ForLabels(map[string]string{"app": "other"}).Parse(`{"msg":"ok"}`)
+		assert.NoError(t, err)
+
+		_, err = registry.Default().Parse("level=info msg=ok")
+		assert.Error(t, err)
+	})
+
+	t.Run("Should fail with an invalid selector", func(t *testing.T) {
+		_, err := parser.NewRegistry([]domain.ParserConfig{{Selector: "app in (", Type: domain.LogTypeJson}})
+		assert.Error(t, err)
+	})
+}
+
+func TestLogfmtPerformance(t *testing.T) {
+	// Arrange
+	store, err := db.NewStore(domain.StoreOptionsType{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer store.Close()
+	sink := repository.NewSQLiteSink(store)
+	writerCtx, cancel := context.WithCancel(context.Background())
+	repository.StartWriterWorker(writerCtx, sink, domain.WriterOptionsType{BatchSize: 10})
+	repository.StartGeneralLogWorker(writerCtx, sink, domain.WriterOptionsType{BatchSize: 10})
+
+	p, err := parser.New(domain.ParserConfig{Type: domain.LogTypeLogfmt})
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), domain.CtxKeyType("logPerform"), true)
+	source := domain.LogSourceType{Pod: "pod-a"}
+	perf := `msg="{title: 'perf', performanceInfo: [{exectime: 12, method: 'createCharge', memoryUsage: '64'}]}"`
+
+	// Act
+	assert.NotPanics(t, func() {
+		repository.SaveLog(ctx, p, source, "level=info ts=2025-05-15T17:22:59Z trace_id=t1 "+perf)
+		repository.SaveLog(ctx, p, source, "level=info trace_id=t2 "+perf)
+	})
+	cancel()
+	repository.WaitWriters()
+
+	// Assert
+	rows, err := store.DB().Query("SELECT trace_id, CAST(timestamp AS TEXT) FROM performance_logs")
+	require.NoError(t, err)
+	defer rows.Close()
+	var traces, timestamps []string
+	for rows.Next() {
+		var traceId, timestamp string
+		require.NoError(t, rows.Scan(&traceId, &timestamp))
+		traces = append(traces, traceId)
+		timestamps = append(timestamps, timestamp)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"t1"}, traces, "La línea sin timestamp no debería guardar performance")
+	assert.Equal(t, []string{"2025-05-15T17:22:59Z"}, timestamps)
+}
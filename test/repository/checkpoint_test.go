@@ -0,0 +1,175 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/db"
+	"github.com/jmticonap/real-logs/infrastructure/parser"
+	"github.com/jmticonap/real-logs/infrastructure/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openRepositoryStore(t *testing.T) *db.Store {
+	t.Helper()
+	store, err := db.NewStore(domain.StoreOptionsType{Dir: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+// writerContext is cancelled at the end of the test, waiting for the
+// writers before the store of openRepositoryStore is closed.
+func writerContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		repository.WaitWriters()
+	})
+
+	return ctx
+}
+
+func TestCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	source := domain.LogSourceType{Cluster: "qa", Namespace: "default", Pod: "pod-a", Container: "app"}
+
+	t.Run("Should report a container never streamed", func(t *testing.T) {
+		conn := openRepositoryStore(t).DB()
+
+		_, found, err := repository.GetCheckpoint(ctx, conn, source)
+		assert.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("Should keep the last position of a container", func(t *testing.T) {
+		conn := openRepositoryStore(t).DB()
+		first := domain.StreamCheckpointType{
+			Cluster:          "qa",
+			Namespace:        "default",
+			Pod:              "pod-a",
+			Container:        "app",
+			Restart:          1,
+			LastTimestamp:    time.Date(2025, 5, 19, 17, 0, 0, 123456789, time.UTC),
+			LinesAtTimestamp: 2,
+			Line:             40,
+		}
+		require.NoError(t, repository.SaveCheckpoint(ctx, conn, first))
+
+		last := first
+		last.LastTimestamp = first.LastTimestamp.Add(time.Second)
+		last.LinesAtTimestamp = 1
+		last.Line = 41
+		require.NoError(t, repository.SaveCheckpoint(ctx, conn, last))
+
+		got, found, err := repository.GetCheckpoint(ctx, conn, source)
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.True(t, last.LastTimestamp.Equal(got.LastTimestamp), "El timestamp debe conservar los nanosegundos")
+		got.LastTimestamp = last.LastTimestamp
+		assert.Equal(t, last, got)
+	})
+
+	t.Run("Should keep the checkpoints of each cluster apart", func(t *testing.T) {
+		conn := openRepositoryStore(t).DB()
+		require.NoError(t, repository.SaveCheckpoint(ctx, conn, domain.StreamCheckpointType{
+			Cluster:       "qa",
+			Namespace:     "default",
+			Pod:           "pod-a",
+			Container:     "app",
+			LastTimestamp: time.Now(),
+		}))
+
+		other := source
+		other.Cluster = "dr"
+		_, found, err := repository.GetCheckpoint(ctx, conn, other)
+		assert.NoError(t, err)
+		assert.False(t, found)
+	})
+}
+
+// gatedSink holds the general log inserts of the wrapped sink until
+// release is closed, and fails them when fail is set.
+type gatedSink struct {
+	repository.LogSink
+	release chan struct{}
+	fail    bool
+}
+
+func (s *gatedSink) InsertGeneralLogs(ctx context.Context, batch []domain.GeneralLogRecordType) error {
+	<-s.release
+	if s.fail {
+		return errors.New("disco lleno")
+	}
+	return s.LogSink.InsertGeneralLogs(ctx, batch)
+}
+
+func TestLineTracker(t *testing.T) {
+	source := domain.LogSourceType{Cluster: "qa", Namespace: "default", Pod: "pod-a", Container: "app"}
+	start := domain.StreamCheckpointType{Cluster: "qa", Namespace: "default", Pod: "pod-a", Container: "app"}
+	p, err := parser.New(domain.ParserConfig{Type: domain.LogTypeRegex, Pattern: `^(?P<msg>.*)$`})
+	require.NoError(t, err)
+
+	// push tracks and queues the lines 1..n of the stream
+	push := func(ctx context.Context, tracker *repository.LineTracker, n int) {
+		for i := 1; i <= n; i++ {
+			checkpoint := start
+			checkpoint.Line = i
+			checkpoint.LastTimestamp = time.Date(2025, 5, 19, 17, 0, i, 0, time.UTC)
+			checkpoint.LinesAtTimestamp = 1
+			tracker.Track(checkpoint)
+			source.Line = i
+			repository.IngestPushTracked(ctx, p, source, fmt.Sprintf("line %d", i), tracker)
+		}
+	}
+
+	t.Run("Should save the checkpoint only after the lines are stored", func(t *testing.T) {
+		store := openRepositoryStore(t)
+		sink := &gatedSink{LogSink: repository.NewSQLiteSink(store), release: make(chan struct{})}
+		ctx := writerContext(t)
+		repository.StartGeneralLogWorker(ctx, sink, domain.WriterOptionsType{BatchSize: 10, FlushInterval: 10 * time.Millisecond})
+
+		saved := make(chan domain.StreamCheckpointType, 10)
+		tracker := repository.NewLineTracker(start, time.Hour, func(checkpoint domain.StreamCheckpointType) {
+			saved <- checkpoint
+		})
+		push(ctx, tracker, 3)
+		tracker.Close()
+
+		assert.Never(t, func() bool { return len(saved) > 0 }, 200*time.Millisecond, 10*time.Millisecond,
+			"No debe guardarse el checkpoint de líneas que siguen en el writer")
+
+		close(sink.release)
+		select {
+		case checkpoint := <-saved:
+			assert.Equal(t, 3, checkpoint.Line)
+		case <-time.After(2 * time.Second):
+			t.Fatal("El checkpoint no se guardó al insertar las líneas")
+		}
+		assert.Equal(t, 3, countGeneralLogs(t, store.DB()))
+	})
+
+	t.Run("Should not move the checkpoint past a failed insert", func(t *testing.T) {
+		store := openRepositoryStore(t)
+		sink := &gatedSink{LogSink: repository.NewSQLiteSink(store), release: make(chan struct{}), fail: true}
+		close(sink.release)
+		ctx := writerContext(t)
+		repository.StartGeneralLogWorker(ctx, sink, domain.WriterOptionsType{BatchSize: 1})
+
+		saved := make(chan domain.StreamCheckpointType, 10)
+		tracker := repository.NewLineTracker(start, 0, func(checkpoint domain.StreamCheckpointType) {
+			saved <- checkpoint
+		})
+		push(ctx, tracker, 2)
+		tracker.Close()
+
+		assert.Never(t, func() bool { return len(saved) > 0 }, 200*time.Millisecond, 10*time.Millisecond)
+	})
+}
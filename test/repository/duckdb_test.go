@@ -0,0 +1,118 @@
+//go:build duckdb
+
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// duckdbCount counts the rows of table once the sink is closed, since a
+// DuckDB file is opened by one database at a time.
+func duckdbCount(t *testing.T, path, table string) int {
+	t.Helper()
+	conn, err := sql.Open("duckdb", path)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var n int
+	require.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM "+table).Scan(&n))
+	return n
+}
+
+func TestDuckDBSink(t *testing.T) {
+	ctx := context.Background()
+	source := domain.LogSourceType{Cluster: "qa", Namespace: "payments", Pod: "pod-a", Container: "app", Line: 7}
+
+	t.Run("Should append a batch bigger than an appender chunk", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.duckdb")
+		sink, err := repository.NewDuckDBSink(path)
+		require.NoError(t, err)
+
+		// El appender vuelca solo cada 2048 filas
+		batch := make([]domain.GeneralLogRecordType, 3000)
+		for i := range batch {
+			batch[i] = domain.GeneralLogRecordType{
+				LogType: domain.LogType{Level: "INFO", Timestamp: "2025-05-15T17:22:59.820-05:00", Msg: fmt.Sprintf("line %d", i)},
+				Source:  source,
+			}
+		}
+		batch[0].Timestamp = ""
+		batch[1].Timestamp = "15/05/2025 17:22:59"
+		require.NoError(t, sink.InsertGeneralLogs(ctx, batch))
+		require.NoError(t, sink.Close())
+
+		assert.Equal(t, 3000, duckdbCount(t, path, "general_logs"))
+		conn, err := sql.Open("duckdb", path)
+		require.NoError(t, err)
+		defer conn.Close()
+		var nulls, line int
+		var first time.Time
+		var text string
+		require.NoError(t, conn.QueryRow(
+			"SELECT COUNT(*) FILTER (WHERE timestamp IS NULL), MIN(line_offset), MIN(timestamp), MIN(timestamp_text) FROM general_logs",
+		).Scan(&nulls, &line, &first, &text))
+		assert.Equal(t, 2, nulls, "Un timestamp vacío o desconocido se guarda como NULL")
+		assert.Equal(t, "15/05/2025 17:22:59", text, "El timestamp desconocido se conserva como texto")
+		assert.Equal(t, 7, line)
+		assert.True(t, first.Equal(time.Date(2025, 5, 15, 22, 22, 59, 820_000_000, time.UTC)))
+	})
+
+	t.Run("Should append raw lines and performance logs", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.duckdb")
+		sink, err := repository.NewDuckDBSink(path)
+		require.NoError(t, err)
+
+		require.NoError(t, sink.InsertRawLines(ctx, []domain.RawLineType{
+			{Source: source, IngestTime: time.Now(), Text: "panic: boom"},
+			// Una línea binaria no debe hacer fallar el batch
+			{Source: source, IngestTime: time.Now(), Text: "SQLite format 3\x00\xff\xfe"},
+		}))
+		require.NoError(t, sink.InsertPerformanceLogs(ctx, []domain.LogChanDataType{
+			{Params: []any{"trace-1", "createCharge", float32(12.5), "64", "2025-05-19T12:00:00.100-05:00"}},
+		}))
+		require.NoError(t, sink.Close())
+
+		assert.Equal(t, 2, duckdbCount(t, path, "raw_lines"))
+		assert.Equal(t, 1, duckdbCount(t, path, "performance_logs"))
+	})
+
+	t.Run("Should store nothing of a batch with a bad row", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.duckdb")
+		sink, err := repository.NewDuckDBSink(path)
+		require.NoError(t, err)
+
+		batch := make([]domain.LogChanDataType, 2500)
+		for i := range batch {
+			batch[i] = domain.LogChanDataType{Params: []any{"trace-1", "createCharge", float32(i), "64", "2025-05-19T12:00:00.100-05:00"}}
+		}
+		// Un exectime que no es número: el appender lo rechaza tras volcar 2048 filas
+		batch[len(batch)-1].Params[2] = struct{}{}
+
+		assert.Error(t, sink.InsertPerformanceLogs(ctx, batch))
+		require.NoError(t, sink.Close())
+
+		assert.Zero(t, duckdbCount(t, path, "performance_logs"))
+	})
+
+	t.Run("Should keep the tables when the file is opened again", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.duckdb")
+		for range 2 {
+			sink, err := repository.NewDuckDBSink(path)
+			require.NoError(t, err)
+			require.NoError(t, sink.InsertRawLines(ctx, []domain.RawLineType{{Source: source, IngestTime: time.Now()}}))
+			require.NoError(t, sink.Close())
+		}
+
+		assert.Equal(t, 2, duckdbCount(t, path, "raw_lines"))
+	})
+}
@@ -0,0 +1,94 @@
+package repository_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/parser"
+	"github.com/jmticonap/real-logs/infrastructure/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestPipeline(t *testing.T) {
+	store := openRepositoryStore(t)
+	conn := store.DB()
+	ctx := writerContext(t)
+	repository.StartGeneralLogWorker(ctx, repository.NewSQLiteSink(store), domain.WriterOptionsType{BatchSize: 1})
+
+	p, err := parser.New(domain.ParserConfig{Type: domain.LogTypeRegex, Pattern: `^(?P<msg>.*)$`})
+	require.NoError(t, err)
+
+	// Colas de una línea para forzar el backpressure
+	repository.StartIngestPipeline(ctx, domain.IngestOptionsType{Workers: 2, QueueSize: 1})
+
+	const linesPerPod = 200
+	pods := []string{"pod-a", "pod-b", "pod-c"}
+	done := make(chan struct{})
+	for _, pod := range pods {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			source := domain.LogSourceType{Namespace: "qa", Pod: pod, Container: "app"}
+			for i := 1; i <= linesPerPod; i++ {
+				source.Line = i
+				repository.IngestPush(ctx, p, source, fmt.Sprintf("line %d", i))
+			}
+		}()
+	}
+	for range pods {
+		<-done
+	}
+
+	stats := repository.StopIngestPipeline()
+	assert.Equal(t, int64(len(pods)*linesPerPod), stats.Queued)
+	assert.Equal(t, stats.Queued, stats.Processed, "Stop debe esperar a que se procesen todas las líneas")
+	assert.Zero(t, stats.Pending)
+
+	require.Eventually(t, func() bool {
+		var count int
+		return conn.QueryRow("SELECT COUNT(*) FROM general_logs").Scan(&count) == nil && count == len(pods)*linesPerPod
+	}, 5*time.Second, 20*time.Millisecond)
+
+	for _, pod := range pods {
+		rows, err := conn.Query("SELECT line_offset FROM general_logs WHERE pod = ? ORDER BY id", pod)
+		require.NoError(t, err)
+		previous := 0
+		for rows.Next() {
+			var line int
+			require.NoError(t, rows.Scan(&line))
+			assert.Equal(t, previous+1, line, "Las líneas de %s deben conservar su orden", pod)
+			previous = line
+		}
+		require.NoError(t, rows.Err())
+		rows.Close()
+	}
+}
+
+func TestIngestPipelineStartTwice(t *testing.T) {
+	store := openRepositoryStore(t)
+	ctx := writerContext(t)
+	repository.StartGeneralLogWorker(ctx, repository.NewSQLiteSink(store), domain.WriterOptionsType{BatchSize: 1})
+
+	p, err := parser.New(domain.ParserConfig{Type: domain.LogTypeRegex, Pattern: `^(?P<msg>.*)$`})
+	require.NoError(t, err)
+
+	source := domain.LogSourceType{Namespace: "qa", Pod: "pod-a", Container: "app"}
+	push := func(from, to int) {
+		for i := from; i <= to; i++ {
+			source.Line = i
+			repository.IngestPush(ctx, p, source, fmt.Sprintf("line %d", i))
+		}
+	}
+
+	repository.StartIngestPipeline(ctx, domain.IngestOptionsType{Workers: 1, QueueSize: 10})
+	push(1, 3)
+	repository.StartIngestPipeline(ctx, domain.IngestOptionsType{Workers: 4, QueueSize: 10})
+	push(4, 5)
+
+	stats := repository.StopIngestPipeline()
+	assert.Equal(t, int64(5), stats.Queued, "El segundo inicio no debe reemplazar el pipeline en marcha")
+	assert.Equal(t, stats.Queued, stats.Processed)
+	assert.Equal(t, domain.IngestStatsType{}, repository.StopIngestPipeline())
+}
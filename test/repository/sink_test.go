@@ -0,0 +1,79 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteSink(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should insert batches over the SQLite variable limit", func(t *testing.T) {
+		store := openRepositoryStore(t)
+		sink := repository.NewSQLiteSink(store)
+		defer sink.Close()
+
+		// 15 columnas por fila: el batch supera el límite de variables
+		rows := store.VariableLimit()/15*3 + 7
+		batch := make([]domain.GeneralLogRecordType, rows)
+		for i := range batch {
+			batch[i] = domain.GeneralLogRecordType{
+				LogType: domain.LogType{Level: "INFO", Msg: fmt.Sprintf("line %d", i)},
+				Source:  domain.LogSourceType{Pod: "pod-a", Line: i + 1},
+			}
+		}
+
+		require.NoError(t, sink.InsertGeneralLogs(ctx, batch))
+		// Las sentencias preparadas se reutilizan en el siguiente batch
+		require.NoError(t, sink.InsertGeneralLogs(ctx, batch[:3]))
+
+		assert.Equal(t, rows+3, countGeneralLogs(t, store.DB()))
+		var first, last int
+		require.NoError(t, store.DB().QueryRow("SELECT MIN(line_offset), MAX(line_offset) FROM general_logs").Scan(&first, &last))
+		assert.Equal(t, 1, first)
+		assert.Equal(t, rows, last)
+	})
+
+	t.Run("Should insert raw lines and performance logs", func(t *testing.T) {
+		store := openRepositoryStore(t)
+		sink := repository.NewSQLiteSink(store)
+		defer sink.Close()
+
+		require.NoError(t, sink.InsertRawLines(ctx, []domain.RawLineType{
+			{Source: domain.LogSourceType{Pod: "pod-a"}, IngestTime: time.Now(), Text: "panic: boom"},
+		}))
+		require.NoError(t, sink.InsertPerformanceLogs(ctx, []domain.LogChanDataType{
+			{Params: []any{"trace-1", "createCharge", float32(12.5), "64", "2025-05-19T12:00:00.100-05:00"}},
+		}))
+
+		var raw, performance int
+		require.NoError(t, store.DB().QueryRow("SELECT COUNT(*) FROM raw_lines").Scan(&raw))
+		require.NoError(t, store.DB().QueryRow("SELECT COUNT(*) FROM performance_logs").Scan(&performance))
+		assert.Equal(t, 1, raw)
+		assert.Equal(t, 1, performance)
+	})
+
+	t.Run("Should not insert part of a failed batch", func(t *testing.T) {
+		store := openRepositoryStore(t)
+		sink := repository.NewSQLiteSink(store)
+		defer sink.Close()
+
+		// trace_id es NOT NULL: la segunda fila hace fallar la transacción
+		err := sink.InsertPerformanceLogs(ctx, []domain.LogChanDataType{
+			{Params: []any{"trace-1", "createCharge", float32(1), "64", "2025-05-19T12:00:00.100-05:00"}},
+			{Params: []any{nil, "createCharge", float32(1), "64", "2025-05-19T12:00:00.100-05:00"}},
+		})
+
+		assert.Error(t, err)
+		var performance int
+		require.NoError(t, store.DB().QueryRow("SELECT COUNT(*) FROM performance_logs").Scan(&performance))
+		assert.Zero(t, performance)
+	})
+}
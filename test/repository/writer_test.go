@@ -0,0 +1,124 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func countGeneralLogs(t *testing.T, conn *sql.DB) int {
+	t.Helper()
+	var count int
+	require.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM general_logs").Scan(&count))
+
+	return count
+}
+
+func pushGeneralLogs(n int, msg string) {
+	for range n {
+		repository.GeneralChanPush(domain.LogType{Level: "INFO", Msg: msg}, domain.LogSourceType{Pod: "pod-a"})
+	}
+}
+
+func TestBatchWriter(t *testing.T) {
+	t.Run("Should flush an incomplete batch after the interval", func(t *testing.T) {
+		store := openRepositoryStore(t)
+		conn := store.DB()
+		ctx := writerContext(t)
+		repository.StartGeneralLogWorker(ctx, repository.NewSQLiteSink(store), domain.WriterOptionsType{
+			BatchSize:     100,
+			FlushInterval: 50 * time.Millisecond,
+		})
+
+		pushGeneralLogs(3, "quiet service")
+
+		assert.Eventually(t, func() bool {
+			return countGeneralLogs(t, conn) == 3
+		}, 2*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Should flush when the batch reaches max bytes", func(t *testing.T) {
+		store := openRepositoryStore(t)
+		conn := store.DB()
+		ctx := writerContext(t)
+		repository.StartGeneralLogWorker(ctx, repository.NewSQLiteSink(store), domain.WriterOptionsType{
+			BatchSize: 100,
+			MaxBytes:  64,
+		})
+
+		pushGeneralLogs(2, "a message longer than thirty-two bytes")
+
+		assert.Eventually(t, func() bool {
+			return countGeneralLogs(t, conn) == 2
+		}, 2*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Should insert a batch flushed while the context is cancelled", func(t *testing.T) {
+		store := openRepositoryStore(t)
+		conn := store.DB()
+		sink := &gatedSink{LogSink: repository.NewSQLiteSink(store), release: make(chan struct{})}
+
+		// La fila siguiente queda en el canal con el contexto ya cancelado:
+		// el writer puede tomarla antes de ver la cancelación
+		const rounds = 20
+		for range rounds {
+			ctx, cancel := context.WithCancel(context.Background())
+			repository.StartGeneralLogWorker(ctx, sink, domain.WriterOptionsType{BatchSize: 1})
+			pushGeneralLogs(2, "stopping")
+			cancel()
+			sink.release <- struct{}{}
+			sink.release <- struct{}{}
+			repository.WaitWriters()
+		}
+
+		assert.Equal(t, 2*rounds, countGeneralLogs(t, conn))
+	})
+
+	t.Run("Should drain the channel when the context is cancelled", func(t *testing.T) {
+		store := openRepositoryStore(t)
+		conn := store.DB()
+		ctx, cancel := context.WithCancel(context.Background())
+		repository.StartGeneralLogWorker(ctx, repository.NewSQLiteSink(store), domain.WriterOptionsType{BatchSize: 100})
+
+		pushGeneralLogs(5, "last lines")
+		cancel()
+		repository.WaitWriters()
+
+		assert.Equal(t, 5, countGeneralLogs(t, conn))
+	})
+	t.Run("Should keep every performance entry of a log", func(t *testing.T) {
+		store := openRepositoryStore(t)
+		conn := store.DB()
+		ctx, cancel := context.WithCancel(context.Background())
+		repository.StartWriterWorker(ctx, repository.NewSQLiteSink(store), domain.WriterOptionsType{BatchSize: 100})
+
+		repository.LogChanPush(
+			domain.LogType{TraceId: "trace-1", Timestamp: "2025-05-15T17:22:59.820-05:00"},
+			[]domain.PerformanceType{
+				{Method: "GET /orders", Exectime: 10},
+				{Method: "GET /stock", Exectime: 20},
+				{Method: "POST /charge", Exectime: 30},
+			},
+		)
+		cancel()
+		repository.WaitWriters()
+
+		rows, err := conn.Query("SELECT method FROM performance_logs ORDER BY exectime")
+		require.NoError(t, err)
+		defer rows.Close()
+		methods := []string{}
+		for rows.Next() {
+			var method string
+			require.NoError(t, rows.Scan(&method))
+			methods = append(methods, method)
+		}
+		require.NoError(t, rows.Err())
+		assert.Equal(t, []string{"GET /orders", "GET /stock", "POST /charge"}, methods)
+	})
+}
@@ -0,0 +1,89 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitTargets(t *testing.T) {
+	cfg := &domain.Config{
+		Namespace:     "ecommerce-qas",
+		LabelSelector: "app=se-core-charge",
+		LogDirectory:  "./logs",
+		Kubeconfig:    "/home/qa/.kube/config",
+	}
+
+	t.Run("Should return the config itself without targets", func(t *testing.T) {
+		configs := service.SplitTargets(cfg)
+
+		require.Len(t, configs, 1)
+		assert.Same(t, cfg, configs[0])
+	})
+
+	t.Run("Should merge every target with the top-level config", func(t *testing.T) {
+		multi := *cfg
+		multi.Targets = []domain.TargetConfig{
+			{Name: "primary", Context: "qa"},
+			{Context: "dr", Namespaces: []string{"ecommerce-dr"}, LabelSelector: "app=charge"},
+		}
+
+		configs := service.SplitTargets(&multi)
+
+		require.Len(t, configs, 2)
+		assert.Equal(t, "primary", configs[0].Cluster)
+		assert.Equal(t, "qa", configs[0].Context)
+		assert.Equal(t, "ecommerce-qas", configs[0].Namespace)
+		assert.Equal(t, "app=se-core-charge", configs[0].LabelSelector)
+		assert.Equal(t, "/home/qa/.kube/config", configs[0].Kubeconfig)
+		assert.Empty(t, configs[0].Targets)
+
+		assert.Equal(t, "dr", configs[1].Cluster)
+		assert.Empty(t, configs[1].Namespace)
+		assert.Equal(t, []string{"ecommerce-dr"}, configs[1].Namespaces)
+		assert.Equal(t, "app=charge", configs[1].LabelSelector)
+		assert.Equal(t, "./logs", configs[1].LogDirectory)
+	})
+
+	t.Run("Should keep the namespaces of the flag over the ones of the targets", func(t *testing.T) {
+		multi := *cfg
+		multi.Targets = []domain.TargetConfig{
+			{Name: "primary", Context: "qa", Namespace: "ecommerce-qa"},
+			{Context: "dr", Namespaces: []string{"ecommerce-dr"}},
+		}
+
+		service.SetNamespaces(&multi, []string{"payments", "orders"})
+		configs := service.SplitTargets(&multi)
+
+		require.Len(t, configs, 2)
+		for _, target := range configs {
+			assert.Empty(t, target.Namespace)
+			assert.Equal(t, []string{"payments", "orders"}, target.Namespaces)
+		}
+		assert.Equal(t, "ecommerce-qas", cfg.Namespace, "No cambia la config original")
+	})
+}
+
+func TestCheckStore(t *testing.T) {
+	t.Run("Should accept every store when collecting", func(t *testing.T) {
+		for _, store := range []string{"", domain.StoreSqlite, domain.StorePostgres, domain.StoreDuckdb} {
+			assert.NoError(t, service.CheckStore(domain.RealTime, store))
+			assert.NoError(t, service.CheckStore(domain.BetweenTimes, store))
+		}
+	})
+
+	t.Run("Should reject the other stores in the flows that read log.db", func(t *testing.T) {
+		for _, flow := range []string{domain.Query, domain.Search, domain.Trace, domain.Export} {
+			assert.NoError(t, service.CheckStore(flow, domain.StoreSqlite))
+			assert.ErrorContains(t, service.CheckStore(flow, domain.StorePostgres), "-store=postgres")
+			assert.ErrorContains(t, service.CheckStore(flow, domain.StoreDuckdb), "-store=duckdb")
+		}
+	})
+
+	t.Run("Should reject an unknown store", func(t *testing.T) {
+		assert.ErrorContains(t, service.CheckStore(domain.RealTime, "mysql"), "store desconocido")
+	})
+}
@@ -0,0 +1,195 @@
+package service_test
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/service"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportProcess(t *testing.T) {
+	conn := openQueryDb(t)
+	_, err := conn.Exec(`
+		INSERT INTO performance_logs (trace_id, method, exectime, memory_mb, timestamp) VALUES
+		('trace-1', 'createCharge', 12.5, '64', '2025-05-19T12:00:00.100-05:00'),
+		('trace-2', 'callService', 3000, '70', '2025-05-19T13:05:00.100-05:00')
+	`)
+	require.NoError(t, err)
+	_, err = conn.Exec("UPDATE general_logs SET cluster = 'qa', namespace = 'payments' WHERE pod = 'pod-a'")
+	require.NoError(t, err)
+	lima := time.FixedZone("Lima", -5*60*60)
+
+	export := func(t *testing.T, filter domain.LogFilter, format, partition string) string {
+		t.Helper()
+		dir := t.TempDir()
+		require.NoError(t, service.ExportProcess(context.Background(), conn, filter, domain.ExportOptionsType{
+			Dir:       dir,
+			Format:    format,
+			Partition: partition,
+			Location:  lima,
+		}))
+		return dir
+	}
+
+	t.Run("Should write one ndjson file per cluster, namespace and pod", func(t *testing.T) {
+		dir := export(t, domain.LogFilter{}, domain.OutputNdjson, domain.PartitionPod)
+
+		content, err := os.ReadFile(filepath.Join(dir, "general_logs", "qa", "payments", "pod-a.ndjson"))
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		require.Len(t, lines, 2)
+		var row map[string]any
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &row))
+		assert.Equal(t, "trace-1", row["trace_id"])
+		assert.Equal(t, "pod-a", row["pod"], "Las columnas del origen deben quedar al primer nivel")
+
+		// Sin clúster ni namespace la fila va a la carpeta unknown
+		assert.FileExists(t, filepath.Join(dir, "general_logs", "unknown", "unknown", "pod-b.ndjson"))
+		// performance_logs no tiene pod: un solo archivo
+		assert.FileExists(t, filepath.Join(dir, "performance_logs.ndjson"))
+	})
+
+	t.Run("Should use the same columns in every format", func(t *testing.T) {
+		ndjsonDir := export(t, domain.LogFilter{}, domain.OutputNdjson, "")
+		csvDir := export(t, domain.LogFilter{}, domain.OutputCsv, "")
+
+		tables := map[string]parquet.Node{
+			"general_logs":     parquet.SchemaOf(domain.ExportLogRow{}),
+			"performance_logs": parquet.SchemaOf(domain.ExportPerformanceRow{}),
+		}
+		for table, schema := range tables {
+			file, err := os.Open(filepath.Join(csvDir, table+".csv"))
+			require.NoError(t, err)
+			header, err := csv.NewReader(file).Read()
+			file.Close()
+			require.NoError(t, err)
+
+			parquetColumns := []string{}
+			for _, field := range schema.Fields() {
+				parquetColumns = append(parquetColumns, field.Name())
+			}
+			assert.ElementsMatch(t, header, parquetColumns, table)
+
+			content, err := os.ReadFile(filepath.Join(ndjsonDir, table+".ndjson"))
+			require.NoError(t, err)
+			for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+				var row map[string]any
+				require.NoError(t, json.Unmarshal([]byte(line), &row))
+				keys := []string{}
+				for key := range row {
+					keys = append(keys, key)
+				}
+				assert.ElementsMatch(t, header, keys, "Cada línea de %s debe tener todas las columnas", table)
+			}
+		}
+	})
+
+	t.Run("Should write one csv file per hour", func(t *testing.T) {
+		dir := export(t, domain.LogFilter{}, domain.OutputCsv, domain.PartitionHour)
+
+		file, err := os.Open(filepath.Join(dir, "general_logs", "2025-05-19T12.csv"))
+		require.NoError(t, err)
+		defer file.Close()
+		records, err := csv.NewReader(file).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 4)
+		assert.Equal(t, "trace_id", records[0][3])
+
+		assert.FileExists(t, filepath.Join(dir, "performance_logs", "2025-05-19T12.csv"))
+		assert.FileExists(t, filepath.Join(dir, "performance_logs", "2025-05-19T13.csv"))
+	})
+
+	t.Run("Should write parquet files with the filtered rows", func(t *testing.T) {
+		dir := export(t, domain.LogFilter{Pod: "pod-b"}, domain.OutputParquet, "")
+
+		logs, err := parquet.ReadFile[domain.ExportLogRow](filepath.Join(dir, "general_logs.parquet"))
+		require.NoError(t, err)
+		require.Len(t, logs, 1)
+		assert.Equal(t, "trace-2", logs[0].TraceId)
+		assert.Equal(t, "pod-b", logs[0].Pod)
+		assert.True(t, logs[0].Timestamp.Equal(time.Date(2025, 5, 19, 12, 5, 0, 0, lima)))
+
+		performance, err := parquet.ReadFile[domain.ExportPerformanceRow](filepath.Join(dir, "performance_logs.parquet"))
+		require.NoError(t, err)
+		require.Len(t, performance, 1, "Solo las trazas del pod filtrado")
+		assert.Equal(t, "callService", performance[0].Method)
+		assert.Equal(t, float32(3000), performance[0].Exectime)
+		assert.True(t, performance[0].Timestamp.Equal(time.Date(2025, 5, 19, 13, 5, 0, 100_000_000, lima)))
+
+		// El timestamp es una columna timestamp de Parquet, no texto
+		file, err := os.Open(filepath.Join(dir, "general_logs.parquet"))
+		require.NoError(t, err)
+		defer file.Close()
+		info, err := file.Stat()
+		require.NoError(t, err)
+		parquetFile, err := parquet.OpenFile(file, info.Size())
+		require.NoError(t, err)
+		column, ok := parquetFile.Schema().Lookup("timestamp")
+		require.True(t, ok)
+		logicalType := column.Node.Type().LogicalType()
+		require.NotNil(t, logicalType)
+		assert.NotNil(t, logicalType.Timestamp)
+	})
+
+	t.Run("Should keep the text of the timestamps that do not parse", func(t *testing.T) {
+		conn := openQueryDb(t)
+		_, err := conn.Exec(`
+			INSERT INTO general_logs (level, timestamp, trace_id, msg, pod) VALUES
+			('INFO', '', 'trace-4', 'sin timestamp', 'pod-c'),
+			('INFO', '2025-05-19 17:07:00', 'trace-5', 'otro formato', 'pod-c')
+		`)
+		require.NoError(t, err)
+		dir := t.TempDir()
+		require.NoError(t, service.ExportProcess(context.Background(), conn, domain.LogFilter{}, domain.ExportOptionsType{
+			Dir:       dir,
+			Format:    domain.OutputCsv,
+			Partition: domain.PartitionHour,
+			Location:  lima,
+		}))
+
+		// SQLite lee el segundo en UTC y lo ordena entre las 12:05 y las
+		// 12:10 de Lima, después de otra partición: va a un archivo nuevo
+		// sin pisar el primero
+		first, err := os.ReadFile(filepath.Join(dir, "general_logs", "unknown.csv"))
+		require.NoError(t, err)
+		assert.Contains(t, string(first), "trace-4")
+		file, err := os.Open(filepath.Join(dir, "general_logs", "unknown-1.csv"))
+		require.NoError(t, err)
+		defer file.Close()
+		records, err := csv.NewReader(file).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		assert.Equal(t, "trace-5", records[1][3])
+		assert.Empty(t, records[1][1])
+		assert.Equal(t, "2025-05-19 17:07:00", records[1][15])
+	})
+
+	t.Run("Should export every row even with a limit", func(t *testing.T) {
+		dir := export(t, domain.LogFilter{Limit: 1}, domain.OutputCsv, "")
+
+		file, err := os.Open(filepath.Join(dir, "general_logs.csv"))
+		require.NoError(t, err)
+		defer file.Close()
+		records, err := csv.NewReader(file).ReadAll()
+		require.NoError(t, err)
+		assert.Len(t, records, 4, "El header y las tres filas")
+	})
+
+	t.Run("Should reject an unknown format", func(t *testing.T) {
+		err := service.ExportProcess(context.Background(), conn, domain.LogFilter{}, domain.ExportOptionsType{
+			Dir:    t.TempDir(),
+			Format: "xlsx",
+		})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,430 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/db"
+	"github.com/jmticonap/real-logs/infrastructure/parser"
+	"github.com/jmticonap/real-logs/infrastructure/repository"
+	"github.com/jmticonap/real-logs/infrastructure/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgotesting "k8s.io/client-go/testing"
+)
+
+const fakeNamespace = "qa"
+
+// newFakeClientset returns a fake cluster and a channel closed once the
+// pod informer is watching, so no event is lost between list and watch.
+func newFakeClientset(pods ...*corev1.Pod) (*fake.Clientset, <-chan struct{}) {
+	clientset := fake.NewClientset()
+	for _, pod := range pods {
+		clientset.Tracker().Add(pod)
+	}
+
+	watching := make(chan struct{})
+	var once sync.Once
+	clientset.PrependWatchReactor("pods", func(action clientgotesting.Action) (bool, watch.Interface, error) {
+		w, err := clientset.Tracker().Watch(action.GetResource(), action.GetNamespace())
+		if err != nil {
+			return false, nil, err
+		}
+		once.Do(func() { close(watching) })
+		return true, w, nil
+	})
+
+	return clientset, watching
+}
+
+func newFakePod(name string, restartCount int32) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: fakeNamespace,
+			Labels:    map[string]string{"app": "demo"},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:       "node-1",
+			InitContainers: []corev1.Container{{Name: "setup"}},
+			Containers:     []corev1.Container{{Name: "app"}},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", RestartCount: restartCount},
+			},
+		},
+	}
+}
+
+// countLogs counts the general_logs rows of one container instance.
+func countLogs(t *testing.T, conn *sql.DB, pod, container string, restart int32) int {
+	t.Helper()
+	var count int
+	err := conn.QueryRow(
+		`SELECT COUNT(*) FROM general_logs
+		WHERE namespace = ? AND pod = ? AND container = ? AND node = 'node-1' AND restart_count = ?`,
+		fakeNamespace,
+		pod,
+		container,
+		restart,
+	).Scan(&count)
+	require.NoError(t, err)
+
+	return count
+}
+
+// previousLogRequests counts the log requests with Previous set.
+func previousLogRequests(clientset *fake.Clientset) int {
+	return logRequests(clientset, func(options *corev1.PodLogOptions) bool {
+		return options.Previous
+	})
+}
+
+// logRequests counts the log requests whose options match.
+func logRequests(clientset *fake.Clientset, match func(*corev1.PodLogOptions) bool) int {
+	count := 0
+	for _, action := range clientset.Actions() {
+		generic, ok := action.(clientgotesting.GenericAction)
+		if !ok || action.GetSubresource() != "log" {
+			continue
+		}
+		options, ok := generic.GetValue().(*corev1.PodLogOptions)
+		if ok && match(options) {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestKubernetesFlows(t *testing.T) {
+	// Los flujos y los workers comparten la base de datos del directorio
+	logDir := t.TempDir()
+	store, err := db.NewStore(domain.StoreOptionsType{Dir: logDir})
+	require.NoError(t, err)
+	defer store.Close()
+	conn := store.DB()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		// Los writers terminan antes de cerrar el store
+		cancel()
+		repository.WaitWriters()
+	}()
+	sink := repository.NewSQLiteSink(store)
+	repository.StartGeneralLogWorker(ctx, sink, domain.WriterOptionsType{BatchSize: 1})
+	repository.StartRawLineWorker(ctx, sink, domain.WriterOptionsType{BatchSize: 1})
+
+	// El fake responde siempre "fake logs"
+	parsers, err := parser.NewRegistry([]domain.ParserConfig{
+		{Selector: "app=demo", Type: domain.LogTypeRegex, Pattern: `^(?P<msg>.*)$`},
+	})
+	require.NoError(t, err)
+
+	cfg := &domain.Config{Namespace: fakeNamespace, LogDirectory: logDir}
+	flowCtx := context.WithValue(ctx, domain.CtxKeyType("srvName"), "")
+	flowCtx = context.WithValue(flowCtx, domain.CtxKeyType("dir"), "")
+	flowCtx = context.WithValue(flowCtx, domain.CtxKeyType("logPerform"), false)
+
+	t.Run("Should follow pods being added, restarted and deleted", func(t *testing.T) {
+		clientset, watching := newFakeClientset()
+		pods := clientset.CoreV1().Pods(fakeNamespace)
+
+		rtCtx, rtCancel := context.WithCancel(flowCtx)
+		done := make(chan struct{})
+		go func() {
+			assert.NoError(t, service.RealTimeProcess(rtCtx, store, clientset, cfg, parsers))
+			close(done)
+		}()
+		<-watching
+
+		_, err := pods.Create(ctx, newFakePod("demo-1", 0), metav1.CreateOptions{})
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return countLogs(t, conn, "demo-1", "app", 0) > 0 && countLogs(t, conn, "demo-1", "setup", 0) > 0
+		}, 5*time.Second, 20*time.Millisecond, "Deberían guardarse los logs del contenedor y del init container")
+
+		_, err = pods.Update(ctx, newFakePod("demo-1", 1), metav1.UpdateOptions{})
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return previousLogRequests(clientset) == 1 && countLogs(t, conn, "demo-1", "app", 1) > 0
+		}, 5*time.Second, 20*time.Millisecond, "El reinicio debería leer los logs previos y seguir la nueva instancia")
+
+		// Un stream activo se reabre con backoff; tras eliminar el pod no
+		// debe volver a pedirse ningún log
+		require.NoError(t, pods.Delete(ctx, "demo-1", metav1.DeleteOptions{}))
+		streamRequests := func() int {
+			return logRequests(clientset, func(options *corev1.PodLogOptions) bool {
+				return options.Follow
+			})
+		}
+		time.Sleep(100 * time.Millisecond)
+		afterDelete := streamRequests()
+		assert.Never(t, func() bool {
+			return streamRequests() > afterDelete
+		}, 2500*time.Millisecond, 50*time.Millisecond, "El stream de un pod eliminado debería cancelarse")
+
+		rtCancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("RealTimeProcess no terminó al cancelar el contexto")
+		}
+	})
+
+	t.Run("Should reconnect a stream closed without a pod event", func(t *testing.T) {
+		// El fake cierra el stream tras una línea, como un corte del API server
+		clientset, watching := newFakeClientset(newFakePod("demo-7", 0))
+
+		rtCtx, rtCancel := context.WithCancel(flowCtx)
+		done := make(chan struct{})
+		go func() {
+			assert.NoError(t, service.RealTimeProcess(rtCtx, store, clientset, cfg, parsers))
+			close(done)
+		}()
+		<-watching
+
+		assert.Eventually(t, func() bool {
+			return logRequests(clientset, func(options *corev1.PodLogOptions) bool {
+				return options.Container == "app" && options.Follow && !options.Previous
+			}) >= 2
+		}, 5*time.Second, 20*time.Millisecond, "El stream cerrado debería volver a abrirse")
+
+		rtCancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("RealTimeProcess no terminó al cancelar el contexto")
+		}
+	})
+
+	t.Run("Should return an error instead of exiting when a target cannot start", func(t *testing.T) {
+		clientset, _ := newFakeClientset(newFakePod("demo-8", 0))
+		badCfg := &domain.Config{Namespace: fakeNamespace, LogDirectory: logDir, Pods: domain.PodFilterType{Owner: "charge"}}
+
+		end := time.Now()
+		err := service.BetweenTimesProcess(flowCtx, clientset, badCfg, parsers, end.Add(-time.Hour), end, domain.DownloadOptionsType{})
+		assert.ErrorContains(t, err, "owner inválido")
+		assert.ErrorContains(t, service.RealTimeProcess(flowCtx, store, clientset, badCfg, parsers), "owner inválido")
+	})
+
+	t.Run("Should download the logs of the selected pods between times", func(t *testing.T) {
+		clientset, _ := newFakeClientset(newFakePod("demo-2", 0))
+
+		end := time.Date(2025, 5, 19, 17, 30, 0, 0, time.UTC)
+		start := end.Add(-time.Hour)
+		require.NoError(t, service.BetweenTimesProcess(flowCtx, clientset, cfg, parsers, start, end, domain.DownloadOptionsType{}))
+
+		assert.Eventually(t, func() bool {
+			return countLogs(t, conn, "demo-2", "app", 0) > 0
+		}, 5*time.Second, 20*time.Millisecond)
+
+		// Cada rango va en su propio archivo y repetirlo lo reemplaza
+		require.NoError(t, service.BetweenTimesProcess(flowCtx, clientset, cfg, parsers, start, end, domain.DownloadOptionsType{}))
+		content, err := os.ReadFile(filepath.Join(logDir, "demo-2_app_20250519T163000Z_20250519T173000Z.log"))
+		require.NoError(t, err)
+		assert.Equal(t, "fake logs\n", string(content), "Repetir el rango no debe duplicar las líneas del archivo")
+		assert.NoFileExists(t, filepath.Join(logDir, "demo-2_app.log"), "btimes no escribe en el archivo de realtime")
+	})
+
+	t.Run("Should only write to the database with nofile", func(t *testing.T) {
+		clientset, _ := newFakeClientset(newFakePod("demo-6", 0))
+		noFileCtx := context.WithValue(flowCtx, domain.CtxKeyType("noFile"), true)
+
+		end := time.Now()
+		require.NoError(t, service.BetweenTimesProcess(noFileCtx, clientset, cfg, parsers, end.Add(-time.Hour), end, domain.DownloadOptionsType{}))
+
+		assert.Eventually(t, func() bool {
+			return countLogs(t, conn, "demo-6", "app", 0) > 0
+		}, 5*time.Second, 20*time.Millisecond)
+		files, err := filepath.Glob(filepath.Join(logDir, "demo-6_*"))
+		require.NoError(t, err)
+		assert.Empty(t, files)
+	})
+
+	t.Run("Should tag the rows with the cluster", func(t *testing.T) {
+		primary, _ := newFakeClientset(newFakePod("demo-5", 0))
+		dr, _ := newFakeClientset(newFakePod("demo-5", 0))
+		clusters := map[string]*fake.Clientset{"primary": primary, "dr": dr}
+
+		end := time.Now()
+		var wg sync.WaitGroup
+		for name, clientset := range clusters {
+			clusterCfg := &domain.Config{Namespace: fakeNamespace, LogDirectory: logDir, Cluster: name}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, service.BetweenTimesProcess(flowCtx, clientset, clusterCfg, parsers, end.Add(-time.Hour), end, domain.DownloadOptionsType{}))
+			}()
+		}
+		wg.Wait()
+
+		assert.Eventually(t, func() bool {
+			var count int
+			err := conn.QueryRow(
+				"SELECT COUNT(DISTINCT cluster) FROM general_logs WHERE pod = 'demo-5' AND cluster IN ('primary', 'dr')",
+			).Scan(&count)
+			return err == nil && count == 2
+		}, 5*time.Second, 20*time.Millisecond)
+	})
+
+	t.Run("Should select pods by owner, name and annotations", func(t *testing.T) {
+		fromDeployment := newFakePod("charge-7d9f-abcde", 0)
+		fromDeployment.Labels["pod-template-hash"] = "7d9f"
+		fromDeployment.Annotations = map[string]string{"sidecar.istio.io/status": "injected"}
+		fromDeployment.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "charge-7d9f"}}
+		withoutAnnotation := newFakePod("charge-7d9f-fghij", 0)
+		withoutAnnotation.Labels["pod-template-hash"] = "7d9f"
+		withoutAnnotation.OwnerReferences = fromDeployment.OwnerReferences
+		otherOwner := newFakePod("charge-0", 0)
+		otherOwner.Annotations = fromDeployment.Annotations
+		otherOwner.OwnerReferences = []metav1.OwnerReference{{Kind: "StatefulSet", Name: "charge"}}
+		clientset, _ := newFakeClientset(fromDeployment, withoutAnnotation, otherOwner)
+
+		filterCfg := &domain.Config{
+			Namespace:     fakeNamespace,
+			LabelSelector: "app=not-used",
+			LogDirectory:  logDir,
+			Cluster:       "filter",
+			Pods: domain.PodFilterType{
+				Owner:       "Deployment/charge",
+				NameRegex:   "^charge-",
+				Annotations: domain.StrObject{"sidecar.istio.io/status": ""},
+			},
+		}
+		// -srv=* ignora el labelSelector del config
+		allCtx := context.WithValue(flowCtx, domain.CtxKeyType("srvName"), "*")
+
+		end := time.Now()
+		require.NoError(t, service.BetweenTimesProcess(allCtx, clientset, filterCfg, parsers, end.Add(-time.Hour), end, domain.DownloadOptionsType{}))
+
+		assert.Eventually(t, func() bool {
+			return countLogs(t, conn, "charge-7d9f-abcde", "app", 0) > 0
+		}, 5*time.Second, 20*time.Millisecond)
+		var others int
+		require.NoError(t, conn.QueryRow(
+			"SELECT COUNT(*) FROM general_logs WHERE cluster = 'filter' AND pod != 'charge-7d9f-abcde'",
+		).Scan(&others))
+		assert.Zero(t, others, "Solo el pod del Deployment con la anotación debe seleccionarse")
+	})
+
+	t.Run("Should download every container with a bounded pool", func(t *testing.T) {
+		pods := []*corev1.Pod{}
+		for _, name := range []string{"pool-1", "pool-2", "pool-3"} {
+			pods = append(pods, newFakePod(name, 0))
+		}
+		clientset, _ := newFakeClientset(pods...)
+		poolCfg := &domain.Config{Namespace: fakeNamespace, LogDirectory: logDir, Cluster: "pool"}
+		options := domain.DownloadOptionsType{Workers: 2, LimitBytes: 1024, TailLines: 10}
+
+		end := time.Now()
+		require.NoError(t, service.BetweenTimesProcess(flowCtx, clientset, poolCfg, parsers, end.Add(-time.Hour), end, options))
+
+		files, err := filepath.Glob(filepath.Join(logDir, "pool", "pool-*.log"))
+		require.NoError(t, err)
+		assert.Len(t, files, 6, "Un archivo por contenedor e init container")
+
+		requests := 0
+		for _, action := range clientset.Actions() {
+			generic, ok := action.(clientgotesting.GenericAction)
+			if !ok || action.GetSubresource() != "log" {
+				continue
+			}
+			logOptions := generic.GetValue().(*corev1.PodLogOptions)
+			requests++
+			assert.True(t, logOptions.Timestamps)
+			assert.Equal(t, int64(1024), *logOptions.LimitBytes)
+			assert.Equal(t, int64(10), *logOptions.TailLines)
+		}
+		assert.Equal(t, 6, requests)
+	})
+
+	t.Run("Should collect from several namespaces", func(t *testing.T) {
+		other := newFakePod("demo-3", 0)
+		other.Namespace = "staging"
+		clientset, _ := newFakeClientset(newFakePod("demo-4", 0), other)
+		multiCfg := &domain.Config{Namespaces: []string{fakeNamespace, "staging"}, LogDirectory: logDir}
+
+		end := time.Now()
+		require.NoError(t, service.BetweenTimesProcess(flowCtx, clientset, multiCfg, parsers, end.Add(-time.Hour), end, domain.DownloadOptionsType{}))
+
+		assert.Eventually(t, func() bool {
+			var count int
+			err := conn.QueryRow(
+				"SELECT COUNT(DISTINCT namespace) FROM general_logs WHERE pod IN ('demo-3', 'demo-4')",
+			).Scan(&count)
+			return err == nil && count == 2
+		}, 5*time.Second, 20*time.Millisecond)
+	})
+}
+
+func TestGetKubernetesClient(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte(`
+apiVersion: v1
+kind: Config
+clusters:
+- name: qa
+  cluster: {server: "https://qa.example.com"}
+- name: staging
+  cluster: {server: "https://staging.example.com"}
+users:
+- name: tester
+  user: {token: "secret"}
+contexts:
+- name: qa
+  context: {cluster: qa, user: tester, namespace: ecommerce-qas}
+- name: staging
+  context: {cluster: staging, user: tester, namespace: ecommerce-stg}
+current-context: qa
+`), 0644))
+	t.Setenv("KUBECONFIG", "")
+
+	t.Run("Should use the current context", func(t *testing.T) {
+		_, namespace, err := service.GetKubernetesClient(kubeconfig, "")
+		require.NoError(t, err)
+		assert.Equal(t, "ecommerce-qas", namespace)
+	})
+
+	t.Run("Should select another context", func(t *testing.T) {
+		_, namespace, err := service.GetKubernetesClient(kubeconfig, "staging")
+		require.NoError(t, err)
+		assert.Equal(t, "ecommerce-stg", namespace)
+	})
+
+	t.Run("Should read KUBECONFIG when no path is given", func(t *testing.T) {
+		t.Setenv("KUBECONFIG", kubeconfig)
+		_, namespace, err := service.GetKubernetesClient("", "staging")
+		require.NoError(t, err)
+		assert.Equal(t, "ecommerce-stg", namespace)
+	})
+
+	t.Run("Should fail with an unknown context", func(t *testing.T) {
+		_, _, err := service.GetKubernetesClient(kubeconfig, "prod")
+		assert.Error(t, err)
+	})
+}
+
+func TestParseAnnotations(t *testing.T) {
+	assert.Equal(t,
+		domain.StrObject{"team": "payments", "sidecar.istio.io/status": ""},
+		service.ParseAnnotations("team=payments, sidecar.istio.io/status"),
+	)
+}
+
+func TestParseNamespaces(t *testing.T) {
+	assert.Equal(t, []string{"qa", "staging"}, service.ParseNamespaces(" qa, staging,,"))
+	assert.Empty(t, service.ParseNamespaces(""))
+}
@@ -0,0 +1,63 @@
+package service_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/db"
+	"github.com/jmticonap/real-logs/infrastructure/parser"
+	"github.com/jmticonap/real-logs/infrastructure/repository"
+	"github.com/jmticonap/real-logs/infrastructure/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycleShutdown(t *testing.T) {
+	// Writers que otros tests dejaron terminando
+	repository.WaitWriters()
+
+	logDir := t.TempDir()
+	dbDir := t.TempDir()
+	lines := []string{"INFO started", "not a log line", "WARN slow query", "ERROR failed"}
+	require.NoError(t, os.WriteFile(filepath.Join(logDir, "app.log"), []byte(strings.Join(lines, "\n")+"\n"), 0o644))
+
+	p, err := parser.New(domain.ParserConfig{Type: domain.LogTypeRegex, Pattern: `^(?P<level>[A-Z]+) (?P<msg>.*)$`})
+	require.NoError(t, err)
+
+	store, err := db.NewStore(domain.StoreOptionsType{Dir: dbDir})
+	require.NoError(t, err)
+	lifecycle := service.NewLifecycle(context.Background(), store, repository.NewSQLiteSink(store))
+
+	// Sin intervalo y con batches grandes solo el drenado final inserta
+	options := domain.WriterOptionsType{BatchSize: 100}
+	repository.StartGeneralLogWorker(lifecycle.WriterContext(), repository.NewSQLiteSink(store), options)
+	repository.StartRawLineWorker(lifecycle.WriterContext(), repository.NewSQLiteSink(store), options)
+	repository.StartIngestPipeline(lifecycle.WriterContext(), domain.IngestOptionsType{Workers: 2, QueueSize: 10})
+
+	before := repository.IngestSummary()
+	require.NoError(t, service.FromDir(lifecycle.Context(), p, logDir))
+	lifecycle.Stop()
+	summary := lifecycle.Shutdown()
+
+	assert.Equal(t, int64(4), summary.Read-before.Read)
+	assert.Equal(t, int64(3), summary.Parsed-before.Parsed)
+	assert.Equal(t, int64(1), summary.Unparsed-before.Unparsed)
+	assert.Equal(t, int64(4), summary.Stored-before.Stored)
+	assert.Zero(t, summary.Failed-before.Failed)
+	assert.Equal(t, summary, lifecycle.Shutdown(), "Shutdown debe poder llamarse más de una vez")
+
+	assert.Error(t, store.DB().Ping(), "Shutdown debe cerrar la base de datos")
+
+	reopened, err := db.NewStore(domain.StoreOptionsType{Dir: dbDir})
+	require.NoError(t, err)
+	defer reopened.Close()
+	var general, raw int
+	require.NoError(t, reopened.DB().QueryRow("SELECT COUNT(*) FROM general_logs").Scan(&general))
+	require.NoError(t, reopened.DB().QueryRow("SELECT COUNT(*) FROM raw_lines").Scan(&raw))
+	assert.Equal(t, 3, general)
+	assert.Equal(t, 1, raw)
+}
@@ -0,0 +1,142 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/db"
+	"github.com/jmticonap/real-logs/infrastructure/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openQueryDb(t *testing.T) *sql.DB {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "log.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, db.Migrate(conn))
+
+	_, err = conn.Exec(`
+		INSERT INTO general_logs (level, timestamp, hostname, trace_id, span_id, parent_id, msg, pod, container) VALUES
+		('INFO',  '2025-05-19T12:00:00.000-05:00', 'pod-a', 'trace-1', 'span-1', 'trace-1', 'charge created', 'pod-a', 'app'),
+		('ERROR', '2025-05-19T12:05:00.000-05:00', 'pod-b', 'trace-2', 'span-2', 'trace-2', 'timeout calling 100%_service', 'pod-b', 'app'),
+		('INFO',  '2025-05-19T12:10:00.000-05:00', 'pod-a', 'trace-3', 'span-3', 'trace-3', 'charge refunded', 'pod-a', 'istio-proxy')
+	`)
+	require.NoError(t, err)
+
+	return conn
+}
+
+func queryLines(t *testing.T, conn *sql.DB, filter domain.LogFilter, format string) []string {
+	t.Helper()
+	var out bytes.Buffer
+	require.NoError(t, service.QueryProcess(context.Background(), conn, filter, format, &out))
+
+	return strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+}
+
+func TestQueryProcess(t *testing.T) {
+	conn := openQueryDb(t)
+
+	tests := []struct {
+		name      string
+		filter    domain.LogFilter
+		wantTrace []string
+	}{
+		{
+			name:      "SinFiltros",
+			filter:    domain.LogFilter{},
+			wantTrace: []string{"trace-1", "trace-2", "trace-3"},
+		},
+		{
+			name:      "PorNivel",
+			filter:    domain.LogFilter{Level: "error"},
+			wantTrace: []string{"trace-2"},
+		},
+		{
+			name:      "PorHostname",
+			filter:    domain.LogFilter{Hostname: "pod-a"},
+			wantTrace: []string{"trace-1", "trace-3"},
+		},
+		{
+			name:      "PorPodYContenedor",
+			filter:    domain.LogFilter{Pod: "pod-a", Container: "app"},
+			wantTrace: []string{"trace-1"},
+		},
+		{
+			name:      "PorTraceId",
+			filter:    domain.LogFilter{TraceId: "trace-3"},
+			wantTrace: []string{"trace-3"},
+		},
+		{
+			name: "PorRangoDeTiempo",
+			filter: domain.LogFilter{
+				From: time.Date(2025, 5, 19, 17, 4, 0, 0, time.UTC),
+				To:   time.Date(2025, 5, 19, 17, 11, 0, 0, time.UTC),
+			},
+			wantTrace: []string{"trace-2", "trace-3"},
+		},
+		{
+			name:      "PorSubcadenaConComodines",
+			filter:    domain.LogFilter{Msg: "100%_"},
+			wantTrace: []string{"trace-2"},
+		},
+		{
+			name:      "PorRegex",
+			filter:    domain.LogFilter{MsgRegex: regexp.MustCompile(`^charge (created|refunded)$`)},
+			wantTrace: []string{"trace-1", "trace-3"},
+		},
+		{
+			name:      "ConLimite",
+			filter:    domain.LogFilter{Limit: 2},
+			wantTrace: []string{"trace-1", "trace-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := queryLines(t, conn, tt.filter, domain.OutputJson)
+
+			got := []string{}
+			for _, line := range lines {
+				if line == "" {
+					continue
+				}
+				var item domain.GeneralLogRecordType
+				require.NoError(t, json.Unmarshal([]byte(line), &item))
+				got = append(got, item.TraceId)
+			}
+			assert.Equal(t, tt.wantTrace, got)
+		})
+	}
+
+	t.Run("Should print a csv with header", func(t *testing.T) {
+		lines := queryLines(t, conn, domain.LogFilter{TraceId: "trace-1"}, domain.OutputCsv)
+
+		require.Len(t, lines, 2)
+		assert.Equal(t, "timestamp,level,hostname,pod,container,trace_id,span_id,parent_id,msg", lines[0])
+		assert.Contains(t, lines[1], "trace-1")
+	})
+
+	t.Run("Should print a table with header", func(t *testing.T) {
+		lines := queryLines(t, conn, domain.LogFilter{Level: "INFO"}, domain.OutputTable)
+
+		require.Len(t, lines, 3)
+		assert.True(t, strings.HasPrefix(lines[0], "TIMESTAMP"))
+	})
+
+	t.Run("Should fail with an unknown format", func(t *testing.T) {
+		var out bytes.Buffer
+		err := service.QueryProcess(context.Background(), conn, domain.LogFilter{}, "xml", &out)
+		assert.Error(t, err)
+	})
+}
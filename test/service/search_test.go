@@ -0,0 +1,226 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/db"
+	"github.com/jmticonap/real-logs/infrastructure/repository"
+	"github.com/jmticonap/real-logs/infrastructure/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openSearchDb(t *testing.T) *sql.DB {
+	t.Helper()
+	store, err := db.NewStore(domain.StoreOptionsType{Dir: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	if !store.FullTextSearch() {
+		t.Skip("SQLite sin FTS5, ejecutar con -tags sqlite_fts5")
+	}
+
+	_, err = store.DB().Exec(`
+		INSERT INTO general_logs (level, timestamp, trace_id, msg, pod, container) VALUES
+		('INFO',  '2025-05-19T12:00:00.000-05:00', 'trace-1', 'charge created for order 15', 'pod-a', 'app'),
+		('ERROR', '2025-05-19T12:05:00.000-05:00', 'trace-2', 'timeout calling payment gateway after 3000 ms', 'pod-b', 'app'),
+		('WARN',  '2025-05-19T12:07:00.000-05:00', 'trace-3', 'payment gateway slow, retrying', 'pod-a', 'app'),
+		('INFO',  '2025-05-19T12:10:00.000-05:00', 'trace-4', 'charge refunded by payments team', 'pod-a', 'istio-proxy')
+	`)
+	require.NoError(t, err)
+
+	return store.DB()
+}
+
+func searchResults(t *testing.T, conn *sql.DB, filter domain.LogFilter, query string) []domain.SearchResultType {
+	t.Helper()
+	var out bytes.Buffer
+	err := service.SearchProcess(
+		context.Background(),
+		conn,
+		filter,
+		domain.SearchOptionsType{Query: query, HighlightStart: "[", HighlightEnd: "]"},
+		domain.OutputJson,
+		&out,
+	)
+	require.NoError(t, err)
+
+	results := []domain.SearchResultType{}
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var item domain.SearchResultType
+		require.NoError(t, decoder.Decode(&item))
+		results = append(results, item)
+	}
+
+	return results
+}
+
+func traceIds(results []domain.SearchResultType) []string {
+	ids := []string{}
+	for _, item := range results {
+		ids = append(ids, item.TraceId)
+	}
+
+	return ids
+}
+
+func TestSearchProcessWithoutFTS5(t *testing.T) {
+	store, err := db.NewStore(domain.StoreOptionsType{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer store.Close()
+
+	var out bytes.Buffer
+	err = service.SearchProcess(
+		context.Background(),
+		store.DB(),
+		domain.LogFilter{},
+		domain.SearchOptionsType{Query: "timeout"},
+		domain.OutputTable,
+		&out,
+	)
+	if store.FullTextSearch() {
+		assert.NoError(t, err)
+		return
+	}
+	require.ErrorIs(t, err, repository.ErrNoFullTextSearch)
+	assert.Contains(t, err.Error(), "-tags sqlite_fts5", "El error debe nombrar el build tag")
+}
+
+func TestSearchProcess(t *testing.T) {
+	conn := openSearchDb(t)
+
+	tests := []struct {
+		name      string
+		filter    domain.LogFilter
+		query     string
+		wantTrace []string
+	}{
+		{
+			name:      "Termino",
+			query:     "charge",
+			wantTrace: []string{"trace-1", "trace-4"},
+		},
+		{
+			name:      "Frase",
+			query:     `"payment gateway"`,
+			wantTrace: []string{"trace-2", "trace-3"},
+		},
+		{
+			name:      "Prefijo",
+			query:     "payment*",
+			wantTrace: []string{"trace-2", "trace-3", "trace-4"},
+		},
+		{
+			name:      "Booleana",
+			query:     "gateway NOT timeout",
+			wantTrace: []string{"trace-3"},
+		},
+		{
+			name:      "ConFiltros",
+			filter:    domain.LogFilter{Pod: "pod-a", Level: "warn"},
+			query:     "payment*",
+			wantTrace: []string{"trace-3"},
+		},
+		{
+			name:      "ConLimite",
+			filter:    domain.LogFilter{Limit: 1},
+			query:     "charge",
+			wantTrace: []string{"trace-1"},
+		},
+		{
+			name:      "SinResultados",
+			query:     "kafka",
+			wantTrace: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := searchResults(t, conn, tt.filter, tt.query)
+			assert.ElementsMatch(t, tt.wantTrace, traceIds(results))
+		})
+	}
+
+	t.Run("Should highlight the matched terms in the snippet", func(t *testing.T) {
+		results := searchResults(t, conn, domain.LogFilter{}, "timeout")
+		require.Len(t, results, 1)
+		assert.Contains(t, results[0].Snippet, "[timeout]")
+		assert.Equal(t, "timeout calling payment gateway after 3000 ms", results[0].Msg)
+		assert.Equal(t, "pod-b", results[0].Source.Pod)
+	})
+
+	t.Run("Should order by relevance", func(t *testing.T) {
+		_, err := conn.Exec(`
+			INSERT INTO general_logs (level, trace_id, msg) VALUES
+			('INFO', 'trace-5', 'refund refund refund')
+		`)
+		require.NoError(t, err)
+
+		results := searchResults(t, conn, domain.LogFilter{}, "refund*")
+		require.Len(t, results, 2)
+		assert.Equal(t, "trace-5", results[0].TraceId)
+	})
+
+	t.Run("Should print the snippet in the table", func(t *testing.T) {
+		var out bytes.Buffer
+		err := service.SearchProcess(
+			context.Background(),
+			conn,
+			domain.LogFilter{},
+			domain.SearchOptionsType{Query: "retrying", HighlightStart: "**", HighlightEnd: "**"},
+			domain.OutputTable,
+			&out,
+		)
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+		require.Len(t, lines, 2)
+		assert.Contains(t, lines[0], "SNIPPET")
+		assert.Contains(t, lines[1], "**retrying**")
+	})
+
+	t.Run("Should write the snippet and rank columns to csv", func(t *testing.T) {
+		var out bytes.Buffer
+		err := service.SearchProcess(
+			context.Background(),
+			conn,
+			domain.LogFilter{},
+			domain.SearchOptionsType{Query: "created"},
+			domain.OutputCsv,
+			&out,
+		)
+		require.NoError(t, err)
+
+		records, err := csv.NewReader(&out).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		assert.Equal(t, []string{"snippet", "rank"}, records[0][len(records[0])-2:])
+		assert.Equal(t, "charge created for order 15", records[1][len(records[1])-2])
+	})
+
+	t.Run("Should reject an invalid query", func(t *testing.T) {
+		var out bytes.Buffer
+		err := service.SearchProcess(
+			context.Background(),
+			conn,
+			domain.LogFilter{},
+			domain.SearchOptionsType{Query: `"unclosed`},
+			domain.OutputJson,
+			&out,
+		)
+		assert.Error(t, err)
+	})
+
+	t.Run("Should reject an empty query", func(t *testing.T) {
+		var out bytes.Buffer
+		err := service.SearchProcess(context.Background(), conn, domain.LogFilter{}, domain.SearchOptionsType{}, domain.OutputTable, &out)
+		assert.Error(t, err)
+	})
+}
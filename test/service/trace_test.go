@@ -0,0 +1,98 @@
+package service_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmticonap/real-logs/domain"
+	"github.com/jmticonap/real-logs/infrastructure/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildTraceTree(t *testing.T) {
+	entries := []domain.LogType{
+		{Level: "INFO", Timestamp: "2025-05-19T12:00:00.500-05:00", TraceId: "t1", SpanId: "child", ParentId: "root", Msg: "child start"},
+		{Level: "INFO", Timestamp: "2025-05-19T12:00:00.000-05:00", TraceId: "t1", SpanId: "root", ParentId: "t1", Msg: "root start"},
+		{Level: "INFO", Timestamp: "2025-05-19T12:00:02.000-05:00", TraceId: "t1", SpanId: "root", ParentId: "t1", Msg: "root end"},
+		{Level: "INFO", Timestamp: "2025-05-19T12:00:01.000-05:00", TraceId: "t1", SpanId: "child", ParentId: "root", Msg: "child end"},
+		{Level: "INFO", Timestamp: "2025-05-19T12:00:00.700-05:00", TraceId: "t1", SpanId: "grandchild", ParentId: "child", Msg: "grandchild"},
+	}
+	performance := []domain.PerformanceRecordType{
+		{TraceId: "t1", Method: "createCharge", Exectime: 2000, Timestamp: "2025-05-19T17:00:02Z"},
+	}
+
+	t.Run("Should nest spans by parent id", func(t *testing.T) {
+		roots := service.BuildTraceTree(entries, performance)
+
+		require.Len(t, roots, 1)
+		root := roots[0]
+		assert.Equal(t, "root", root.SpanId)
+		require.Len(t, root.Children, 1)
+		assert.Equal(t, "child", root.Children[0].SpanId)
+		require.Len(t, root.Children[0].Children, 1)
+		assert.Equal(t, "grandchild", root.Children[0].Children[0].SpanId)
+	})
+
+	t.Run("Should order entries and compute durations", func(t *testing.T) {
+		roots := service.BuildTraceTree(entries, performance)
+
+		root := roots[0]
+		assert.Equal(t, "root start", root.Entries[0].Msg)
+		assert.Equal(t, "root end", root.Entries[1].Msg)
+		assert.Equal(t, 2*time.Second, root.End.Sub(root.Start))
+		assert.Equal(t, 500*time.Millisecond, root.Children[0].End.Sub(root.Children[0].Start))
+	})
+
+	t.Run("Should attach performance rows to the span logged at the same instant", func(t *testing.T) {
+		roots := service.BuildTraceTree(entries, performance)
+
+		require.Len(t, roots[0].Performance, 1)
+		assert.Equal(t, "createCharge", roots[0].Performance[0].Method)
+		assert.Empty(t, roots[0].Children[0].Performance)
+	})
+
+	t.Run("Should not lose spans that form a cycle", func(t *testing.T) {
+		cyclic := []domain.LogType{
+			{Timestamp: "2025-05-19T12:00:00.000-05:00", SpanId: "a", ParentId: "b"},
+			{Timestamp: "2025-05-19T12:00:01.000-05:00", SpanId: "b", ParentId: "a"},
+		}
+
+		roots := service.BuildTraceTree(cyclic, nil)
+
+		require.Len(t, roots, 1)
+		assert.Equal(t, "a", roots[0].SpanId)
+		require.Len(t, roots[0].Children, 1)
+		assert.Equal(t, "b", roots[0].Children[0].SpanId)
+	})
+}
+
+func TestRenderTrace(t *testing.T) {
+	entries := []domain.LogType{
+		{Level: "INFO", Timestamp: "2025-05-19T12:00:00.000-05:00", SpanId: "root", ParentId: "t1", Msg: "start"},
+		{Level: "INFO", Timestamp: "2025-05-19T12:00:00.250-05:00", SpanId: "child", ParentId: "root", Msg: "work"},
+	}
+	var out bytes.Buffer
+
+	service.RenderTrace(&out, "t1", service.BuildTraceTree(entries, nil))
+
+	assert.Contains(t, out.String(), "Trace t1 | spans=2 entries=2 duración=250ms")
+	assert.Contains(t, out.String(), "  └─ span child +250ms")
+}
+
+func TestRenderTraceLongMessage(t *testing.T) {
+	// 159 letras y una ñ de dos bytes: el corte por bytes la partiría
+	msg := strings.Repeat("a", 159) + "ñandú con acentos"
+	entries := []domain.LogType{
+		{Level: "INFO", Timestamp: "2025-05-19T12:00:00.000-05:00", SpanId: "root", ParentId: "t1", Msg: msg},
+	}
+	var out bytes.Buffer
+
+	service.RenderTrace(&out, "t1", service.BuildTraceTree(entries, nil))
+
+	assert.True(t, utf8.ValidString(out.String()), "El mensaje cortado debe seguir siendo UTF-8 válido")
+	assert.Contains(t, out.String(), strings.Repeat("a", 159)+"ñ…")
+}
@@ -0,0 +1,155 @@
+package utils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmticonap/real-logs/utils"
+)
+
+func TestParseLocation(t *testing.T) {
+	tests := []struct {
+		name       string
+		tz         string
+		wantOffset int
+		wantErr    bool
+	}{
+		{name: "Offset", tz: "-05:00", wantOffset: -5 * 3600},
+		{name: "OffsetPositivo", tz: "+05:30", wantOffset: 5*3600 + 30*60},
+		{name: "UTC", tz: "UTC", wantOffset: 0},
+		{name: "IANA", tz: "America/Lima", wantOffset: -5 * 3600},
+		{name: "OffsetInvalido", tz: "-5", wantErr: true},
+		{name: "NombreInvalido", tz: "Mars/Olympus", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := utils.ParseLocation(tt.tz)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			_, offset := time.Date(2025, 5, 19, 12, 0, 0, 0, loc).Zone()
+			assert.Equal(t, tt.wantOffset, offset)
+		})
+	}
+
+	t.Run("Should default to the local timezone", func(t *testing.T) {
+		loc, err := utils.ParseLocation("")
+		require.NoError(t, err)
+		assert.Equal(t, time.Local, loc)
+	})
+}
+
+func TestParseTimeIn(t *testing.T) {
+	lima := time.FixedZone("-05:00", -5*3600)
+	now := time.Date(2025, 5, 20, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		value    string
+		wantTime time.Time
+		wantErr  bool
+	}{
+		{name: "RFC3339", value: "2025-05-19T23:00:00Z", wantTime: time.Date(2025, 5, 19, 23, 0, 0, 0, time.UTC)},
+		{name: "RFC3339ConOffset", value: "2025-05-19T23:00:00-05:00", wantTime: time.Date(2025, 5, 20, 4, 0, 0, 0, time.UTC)},
+		{name: "FechaSinZona", value: "2025-05-19T23:00", wantTime: time.Date(2025, 5, 19, 23, 0, 0, 0, lima)},
+		{name: "FechaConEspacio", value: "2025-05-19 23:00:30", wantTime: time.Date(2025, 5, 19, 23, 0, 30, 0, lima)},
+		{name: "HoraDelDia", value: "08:15", wantTime: time.Date(2025, 5, 20, 8, 15, 0, 0, lima)},
+		{name: "Invalida", value: "ayer", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := utils.ParseTimeIn(tt.value, lima, now)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.wantTime.Equal(got), "got %v, want %v", got, tt.wantTime)
+		})
+	}
+}
+
+func TestResolveTimeRange(t *testing.T) {
+	lima := time.FixedZone("-05:00", -5*3600)
+	now := time.Date(2025, 5, 20, 9, 0, 0, 0, lima)
+
+	tests := []struct {
+		name       string
+		start, end string
+		since      time.Duration
+		last       time.Duration
+		wantStart  time.Time
+		wantEnd    time.Time
+		wantErr    bool
+	}{
+		{
+			name:      "CruzaMedianoche",
+			start:     "23:00",
+			end:       "01:30",
+			wantStart: time.Date(2025, 5, 19, 23, 0, 0, 0, lima),
+			wantEnd:   time.Date(2025, 5, 20, 1, 30, 0, 0, lima),
+		},
+		{
+			name:      "SinFinHastaAhora",
+			start:     "08:00",
+			wantStart: time.Date(2025, 5, 20, 8, 0, 0, 0, lima),
+			wantEnd:   now,
+		},
+		{
+			name:      "SinFinCruzaMedianoche",
+			start:     "23:00",
+			wantStart: time.Date(2025, 5, 19, 23, 0, 0, 0, lima),
+			wantEnd:   now,
+		},
+		{
+			name:      "Since",
+			since:     45 * time.Minute,
+			wantStart: now.Add(-45 * time.Minute),
+			wantEnd:   now,
+		},
+		{
+			name:      "SinceConFin",
+			since:     2 * time.Hour,
+			end:       "08:30",
+			wantStart: now.Add(-2 * time.Hour),
+			wantEnd:   time.Date(2025, 5, 20, 8, 30, 0, 0, lima),
+		},
+		{
+			name:      "Last",
+			last:      2 * time.Hour,
+			wantStart: now.Add(-2 * time.Hour),
+			wantEnd:   now,
+		},
+		{
+			name:      "FechasCompletas",
+			start:     "2025-05-18T22:00:00Z",
+			end:       "2025-05-19T02:00",
+			wantStart: time.Date(2025, 5, 18, 22, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2025, 5, 19, 2, 0, 0, 0, lima),
+		},
+		{name: "FinAnteriorConFechas", start: "2025-05-19T02:00", end: "2025-05-18T22:00", wantErr: true},
+		{name: "SinceYLast", since: time.Hour, last: time.Hour, wantErr: true},
+		{name: "LastConInicio", start: "08:00", last: time.Hour, wantErr: true},
+		{name: "SinInicio", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := utils.ResolveTimeRange(tt.start, tt.end, tt.since, tt.last, lima, now)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.wantStart.Equal(start), "start %v, want %v", start, tt.wantStart)
+			assert.True(t, tt.wantEnd.Equal(end), "end %v, want %v", end, tt.wantEnd)
+		})
+	}
+}
@@ -346,3 +346,41 @@ func TestGetPerformanceLogInfo(t *testing.T) {
 		},
 	)
 }
+
+func TestExtractTimestamp(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		wantTime time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "TimestampEntreCorchetes",
+			line:     "[2025-05-15T17:22:59-0500] Server started",
+			wantTime: time.Date(2025, 5, 15, 22, 22, 59, 0, time.UTC),
+		},
+		{
+			name:     "TimestampEnJson",
+			line:     `{"level":"INFO","timestamp":"2025-05-15T17:22:59.820-05:00","msg":"ok"}`,
+			wantTime: time.Date(2025, 5, 15, 22, 22, 59, 820000000, time.UTC),
+		},
+		{
+			name:    "SinTimestamp",
+			line:    "    at Object.<anonymous> (/app/index.js:10:5)",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotTime, err := utils.ExtractTimestamp(tt.line)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.True(t, tt.wantTime.Equal(gotTime), "ExtractTimestamp() gotTime = %v, want %v", gotTime, tt.wantTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// clockLayouts are the formats without date, taken as a time of the day.
+var clockLayouts = []string{"15:04", "15:04:05"}
+
+// dateTimeLayouts are the formats with date and without zone, read in
+// the location given to ParseTimeIn.
+var dateTimeLayouts = []string{
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+}
+
+// ParseLocation reads a timezone as an IANA name ("America/Lima"), an
+// offset ("-05:00") or "UTC". An empty value is the local timezone.
+func ParseLocation(tz string) (*time.Location, error) {
+	switch {
+	case tz == "" || strings.EqualFold(tz, "local"):
+		return time.Local, nil
+	case strings.EqualFold(tz, "utc") || tz == "Z":
+		return time.UTC, nil
+	case strings.HasPrefix(tz, "+") || strings.HasPrefix(tz, "-"):
+		offset, err := time.Parse("-07:00", tz)
+		if err != nil {
+			return nil, fmt.Errorf("offset inválido %q, se espera ±HH:MM", tz)
+		}
+		_, seconds := offset.Zone()
+		return time.FixedZone(tz, seconds), nil
+	default:
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("zona horaria inválida %q: %w", tz, err)
+		}
+		return loc, nil
+	}
+}
+
+// ParseTimeIn reads an RFC3339 date-time, a date-time without zone or a
+// time of the day (HH:MM or HH:MM:SS, taken on the day of now). Values
+// without zone are read in loc.
+func ParseTimeIn(value string, loc *time.Location, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range clockLayouts {
+		if clock, err := time.Parse(layout, value); err == nil {
+			day := now.In(loc)
+			return time.Date(
+				day.Year(),
+				day.Month(),
+				day.Day(),
+				clock.Hour(),
+				clock.Minute(),
+				clock.Second(),
+				0,
+				loc,
+			), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("fecha inválida %q: se espera HH:MM, 2006-01-02T15:04 o RFC3339", value)
+}
+
+// ResolveTimeRange builds the [start, end] range of the btimes flow.
+// since and last are relative to now: since replaces start and last is
+// the range that ends now. An empty end is now. When start is a time of
+// the day after end, itself a time of the day or now, the range crosses
+// midnight and start is taken on the previous day.
+func ResolveTimeRange(
+	start, end string,
+	since, last time.Duration,
+	loc *time.Location,
+	now time.Time,
+) (time.Time, time.Time, error) {
+	if since > 0 && last > 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("-since y -last no se pueden usar juntos")
+	}
+	if last > 0 {
+		if start != "" || end != "" {
+			return time.Time{}, time.Time{}, fmt.Errorf("-last no se puede combinar con start ni end")
+		}
+		return now.Add(-last), now, nil
+	}
+
+	var startTime, endTime time.Time
+	var err error
+	switch {
+	case since > 0:
+		if start != "" {
+			return time.Time{}, time.Time{}, fmt.Errorf("-since no se puede combinar con start")
+		}
+		startTime = now.Add(-since)
+	case start != "":
+		if startTime, err = ParseTimeIn(start, loc, now); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("startTime inválido: %w", err)
+		}
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("se requiere start, -since o -last")
+	}
+
+	endTime = now
+	if end != "" {
+		if endTime, err = ParseTimeIn(end, loc, now); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("endTime inválido: %w", err)
+		}
+	}
+	if endTime.Before(startTime) && isClock(start) && (end == "" || isClock(end)) {
+		startTime = startTime.AddDate(0, 0, -1)
+	}
+
+	if endTime.Before(startTime) {
+		return time.Time{}, time.Time{}, fmt.Errorf("endTime no puede ser anterior a startTime")
+	}
+
+	return startTime, endTime, nil
+}
+
+func isClock(value string) bool {
+	for _, layout := range clockLayouts {
+		if _, err := time.Parse(layout, value); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
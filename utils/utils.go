@@ -94,3 +94,31 @@ func GetPerformanceLogInfo(log domain.LogType) ([]domain.PerformanceType, error)
 
 	return performanceLog.PerformanceInfo, nil
 }
+
+// ExtractTimestamp looks for a timestamp in logLine using
+// domain.TimeRegexes.
+func ExtractTimestamp(logLine string) (time.Time, error) {
+	for _, r := range domain.TimeRegexes {
+		if match := r.FindStringSubmatch(logLine); match != nil {
+			return ParseTimestamp(match[1])
+		}
+	}
+	return time.Time{}, fmt.Errorf("no timestamp found")
+}
+
+func ParseTimestamp(s string) (time.Time, error) {
+	formats := []string{
+		time.RFC3339,                    // "2025-05-15T17:22:59-05:00"
+		"2006-01-02T15:04:05Z0700",      // "2025-05-15T17:22:59-0500"
+		"2006-01-02T15:04:05.000Z0700",  // "2025-05-15T17:22:59.820-0500"
+		"2006-01-02T15:04:05.000Z07:00", // "2025-05-15T17:22:59.820-05:00"
+	}
+
+	for _, layout := range formats {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid timestamp format: %s", s)
+}